@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/cloudwego/thriftgo/parser"
@@ -22,6 +25,8 @@ func main() {
 	inputFilesStr := flag.String("input_files", "", "input files")
 	outputPath := flag.String("output", "", "output file path")
 	namespace := flag.String("namespace", "", "thrift namespace")
+	check := flag.Bool("check", false, "fail with the diff if the output file is stale, nothing is written")
+	diff := flag.Bool("diff", false, "print the diff of the stale output file, nothing is written")
 	flag.Parse()
 
 	if err := empty(*inputFilesStr, "input_files"); err != nil {
@@ -50,6 +55,24 @@ func main() {
 		panic(err)
 	}
 
+	if *check || *diff {
+		oldName := "a/" + filepath.ToSlash(*outputPath)
+		existing, err := ioutil.ReadFile(*outputPath)
+		if errors.Is(err, os.ErrNotExist) {
+			oldName = "/dev/null"
+		} else if err != nil {
+			panic(err)
+		}
+		if d := thriftgo_tools.UnifiedDiff(oldName, "b/"+filepath.ToSlash(*outputPath), existing, content); d != "" {
+			fmt.Print(d)
+			fmt.Fprintf(os.Stderr, "%s is out of date, run combine without -check to regenerate it\n", *outputPath)
+			if *check {
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
 	err = ioutil.WriteFile(*outputPath, content, 0644)
 	if err != nil {
 		panic(err)
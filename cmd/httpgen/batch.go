@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/thriftgo/parser"
+
+	generator "github.com/sunyakun/thriftgo-tools"
+)
+
+// ExpandIDLs expands the directories and the glob patterns in the paths of the thrift files, a directory
+// is walked for the .thrift files. The duplicated files are removed and the settings of the first one are kept.
+func ExpandIDLs(idls []IDLConfig) ([]IDLConfig, error) {
+	expanded := make([]IDLConfig, 0, len(idls))
+	seen := make(map[string]bool)
+	add := func(idl IDLConfig, p string) {
+		if abs, err := filepath.Abs(p); err == nil && !seen[abs] {
+			seen[abs] = true
+			idl.Path = p
+			expanded = append(expanded, idl)
+		}
+	}
+
+	for _, idl := range idls {
+		paths := []string{idl.Path}
+		if strings.ContainsAny(idl.Path, "*?[") {
+			matches, err := filepath.Glob(idl.Path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %w", idl.Path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no thrift file matches '%s'", idl.Path)
+			}
+			paths = matches
+		}
+
+		for _, p := range paths {
+			fi, err := os.Stat(p)
+			if err != nil || !fi.IsDir() {
+				// the missing files are reported by the validation
+				add(idl, p)
+				continue
+			}
+			found := false
+			err = filepath.WalkDir(p, func(name string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() && strings.HasSuffix(name, ".thrift") {
+					add(idl, name)
+					found = true
+				}
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, fmt.Errorf("no thrift file in directory '%s'", p)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// Plan resolves the targets to be generated. The files without services only have the thriftgo output.
+// In recursive mode the included files of several targets are generated once as the targets of their own,
+// so that no file is written by more than one thriftgo process.
+func Plan(targets []Target) ([]Target, error) {
+	type key struct{ idl, output string }
+	seen := make(map[key]bool)
+	planned := make([]Target, 0, len(targets))
+	add := func(t Target) bool {
+		idl, _ := filepath.Abs(t.IDL)
+		output, _ := filepath.Abs(t.Output)
+		if seen[key{idl, output}] {
+			return false
+		}
+		seen[key{idl, output}] = true
+		planned = append(planned, t)
+		return true
+	}
+
+	flatten := len(targets) > 1 && targets[0].Recursive
+	includes := make([]Target, 0)
+	packages := make(map[key]string) // the thrift file generating the handlers of a package
+	var errs []string
+	for _, t := range targets {
+		ast, err := parser.ParseFile(t.IDL, nil, flatten)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", t.IDL, strings.TrimSpace(err.Error())))
+			continue
+		}
+		if len(ast.Services) == 0 {
+			t.Handler, t.Router, t.Service, t.Main = "", "", "", ""
+		}
+		t.hasService = len(ast.Services) > 0
+		if flatten {
+			t.Recursive, t.IncludesGenerated = false, true
+			for inc := range ast.DepthFirstSearch() {
+				if inc == ast {
+					continue
+				}
+				it := t
+				it.IDL = filepath.Clean(inc.Filename)
+				// the IR of the thrift file has the structs of the included ones
+				it.Handler, it.Router, it.Service, it.Main, it.IR = "", "", "", "", ""
+				it.hasService = false
+				includes = append(includes, it)
+			}
+		}
+		if !add(t) || t.Handler == "" && t.Router == "" && t.Service == "" && t.IR == "" {
+			continue
+		}
+
+		pkg := key{path.Join(strings.Split(ast.GetNamespaceOrReferenceName("go"), ".")...), filepath.Clean(t.Output)}
+		if prev, ok := packages[pkg]; ok {
+			errs = append(errs, fmt.Sprintf("'%s' and '%s' are generated into the same package '%s' of '%s', "+
+				"their generated files conflict", prev, t.IDL, pkg.idl, pkg.output))
+		}
+		packages[pkg] = t.IDL
+	}
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+	for _, t := range includes {
+		add(t)
+	}
+	return planned, nil
+}
+
+// Result is the outcome of generating a target.
+type Result struct {
+	Target  Target
+	Key     string // the cache key of the inputs
+	Skipped bool   // the inputs and the generated files are unchanged since the last generation
+	Files   []File
+	Output  []byte // the warnings of thriftgo and the plugin
+	Err     error
+}
+
+// GenerateAll generates the targets concurrently by at most jobs workers, the files are written unless
+// dryRun is set. The targets adding their services to the same main are generated one by one.
+// The unchanged targets are skipped unless force is set.
+func GenerateAll(targets []Target, jobs int, dryRun, force bool) []Result {
+	if jobs < 1 {
+		jobs = 1
+	}
+	manifests := loadManifests(targets)
+	locks := make(map[string]*sync.Mutex)
+	for _, t := range targets {
+		if t.Main != "" && locks[t.Main] == nil {
+			locks[t.Main] = &sync.Mutex{}
+		}
+	}
+
+	results := make([]Result, len(targets))
+	shared := generateShared(targets, results, dryRun)
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		if results[i].Err != nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t Target) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if lock := locks[t.Main]; lock != nil {
+				lock.Lock()
+				defer lock.Unlock()
+			}
+			var out bytes.Buffer
+			results[i] = generateTarget(t, manifests[filepath.Clean(t.Output)], dryRun, force, &out)
+			results[i].Output = out.Bytes()
+		}(i, t)
+	}
+	wg.Wait()
+
+	// the shared files are recorded with the files of every target using them
+	for i := range results {
+		if f, ok := shared[i]; ok && !results[i].Skipped && results[i].Err == nil {
+			results[i].Files = append(results[i].Files, f)
+		}
+	}
+	return results
+}
+
+// generateShared generates the files shared by the targets of an output directory once, rather than by every
+// target concurrently, and marks the targets to import them without generating them. They're written unless
+// dryRun is set. The shared files are returned by the indexes of the targets, and the results of the targets
+// are failed if their shared files fail.
+func generateShared(targets []Target, results []Result, dryRun bool) map[int]File {
+	shared := make(map[int]File)
+	files := make(map[string]File)
+	errs := make(map[string]error)
+	for i := range targets {
+		t := &targets[i]
+		// the metadata package is shared if the handlers can import it, or it's generated next to them
+		if t.Prefix == "" && t.Module == "" {
+			continue
+		}
+		dir := filepath.Clean(t.Output)
+		handler, err := generatesHandler(*t)
+		if err != nil {
+			results[i] = Result{Target: *t, Err: err}
+			continue
+		} else if !handler {
+			continue
+		}
+		if _, ok := files[dir]; !ok && errs[dir] == nil {
+			files[dir], errs[dir] = generateMetadata(*t, dryRun)
+		}
+		if err := errs[dir]; err != nil {
+			results[i] = Result{Target: *t, Err: err}
+			continue
+		}
+		t.MetadataGenerated = true
+		shared[i] = files[dir]
+	}
+	return shared
+}
+
+// generatesHandler reports whether the handler of the target's service is generated, at the path of the target
+// or the one declared in the manifest of its template directory.
+func generatesHandler(t Target) (bool, error) {
+	if !t.hasService {
+		return false, nil
+	}
+	m, err := generator.LoadTemplateManifest(t.TemplateDir)
+	if err != nil {
+		return false, err
+	}
+	for _, o := range m.Resolve(map[string]string{generator.HandlerTemplate: t.Handler}) {
+		if o.Template == generator.HandlerTemplate && o.Per == generator.PerService {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// generateMetadata generates the metadata package shared by the handlers of the target's output directory,
+// it's written unless dryRun is set or it's unchanged.
+func generateMetadata(t Target, dryRun bool) (File, error) {
+	g, err := generator.GenerateMetadata(t.TemplateDir, t.Output)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to generate the metadata package: %w", err)
+	}
+	content, err := format.Source([]byte(g.Content))
+	if err != nil {
+		return File{}, fmt.Errorf("failed to format '%s': %w", g.GetName(), err)
+	}
+	f := File{Name: g.GetName(), Content: content}
+	if old, err := ioutil.ReadFile(f.Name); dryRun || err == nil && bytes.Equal(old, content) {
+		return f, nil
+	}
+	return f, WriteFiles([]File{f})
+}
+
+// loadManifests loads the manifests of the output directories of the targets, the invalid ones are
+// reported by Reconcile and the targets of them aren't skipped.
+func loadManifests(targets []Target) map[string]*Manifest {
+	manifests := make(map[string]*Manifest)
+	for _, dir := range outputDirs(targets) {
+		if m, err := LoadManifest(dir); err == nil {
+			manifests[dir] = m
+		}
+	}
+	return manifests
+}
+
+// generateTarget generates the target unless it's unchanged since the generation recorded in the manifest,
+// the files are written unless dryRun is set.
+func generateTarget(t Target, m *Manifest, dryRun, force bool, stderr io.Writer) Result {
+	r := Result{Target: t}
+	// the inputs which can't be hashed, like a broken thrift file, are reported by the generation
+	if key, err := cacheKey(t); err == nil {
+		r.Key = key
+	}
+	if !force && r.Key != "" && m != nil && m.Cached(t.Output, t.IDL, r.Key) {
+		r.Skipped = true
+		return r
+	}
+	r.Files, r.Err = GenerateFiles(t, stderr)
+	if r.Err == nil && !dryRun {
+		r.Err = WriteFiles(r.Files)
+	}
+	return r
+}
+
+// Summarize writes the diagnostics of the results, the warnings repeated by the targets are written once.
+// The results of dryRun are reported as checked rather than generated. It returns the number of the failed targets.
+func Summarize(w io.Writer, results []Result, dryRun bool, elapsed time.Duration) int {
+	failed, skipped := 0, 0
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if r.Skipped {
+			skipped++
+			continue
+		}
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(w, "[ERROR] %s: %v\n", r.Target.IDL, r.Err)
+			for _, line := range strings.Split(strings.TrimSpace(string(r.Output)), "\n") {
+				if line != "" {
+					fmt.Fprintf(w, "    %s\n", line)
+				}
+			}
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(r.Output))
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !seen[line] {
+				seen[line] = true
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+	verb := "generated"
+	if dryRun {
+		verb = "checked"
+	}
+	fmt.Fprintf(w, "%s %d of %d thrift files in %s", verb, len(results)-failed-skipped, len(results),
+		elapsed.Round(time.Millisecond))
+	if skipped > 0 {
+		fmt.Fprintf(w, ", %d unchanged ones are skipped", skipped)
+	}
+	fmt.Fprintln(w)
+	return failed
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"runtime/debug"
+
+	generator "github.com/sunyakun/thriftgo-tools"
+)
+
+// generatorVersion returns the version of httpgen, the vcs revision of the build is added if it's known
+// so that a change of the generator regenerates the code.
+func generatorVersion() string {
+	version := generator.Version
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision":
+				version += "+" + s.Value
+			case s.Key == "vcs.modified" && s.Value == "true":
+				version += "-dirty"
+			}
+		}
+	}
+	return version
+}
+
+// cacheInputs are the settings of a target given by the user, the ones set by Plan for the batch like
+// MetadataGenerated aren't inputs so they don't invalidate the cache.
+type cacheInputs struct {
+	IDL         string
+	Output      string
+	Module      string
+	Prefix      string
+	Handler     string
+	Router      string
+	Service     string
+	Main        string
+	IR          string
+	TemplateDir string
+	Options     Options
+}
+
+// cacheKey hashes the inputs of generating the target, they're the versions of the generator, the settings,
+// the thrift file and the files it includes transitively, and the templates.
+func cacheKey(t Target) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "httpgen %s\nthriftgo %s\n", generatorVersion(), thriftgoVersion())
+	settings, err := json.Marshal(cacheInputs{
+		IDL:         t.IDL,
+		Output:      t.Output,
+		Module:      t.Module,
+		Prefix:      t.Prefix,
+		Handler:     t.Handler,
+		Router:      t.Router,
+		Service:     t.Service,
+		Main:        t.Main,
+		IR:          t.IR,
+		TemplateDir: t.TemplateDir,
+		Options:     t.Options,
+	})
+	if err != nil {
+		return "", err
+	}
+	h.Write(settings)
+
+	files, err := includedFiles(t.IDL)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		if err := hashInput(h, f); err != nil {
+			return "", err
+		}
+	}
+	if t.TemplateDir != "" {
+		err = filepath.WalkDir(t.TemplateDir, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			return hashInput(h, name)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashInput(h hash.Hash, name string) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(h, "\n%s %d\n", filepath.ToSlash(name), len(data))
+	h.Write(data)
+	return nil
+}
+
+// Cached reports whether the thrift file was generated into the output directory from the inputs of the key,
+// and the files generated by it are unchanged since then.
+func (m *Manifest) Cached(dir, idl, key string) bool {
+	rel, err := relPath(dir, idl)
+	if err != nil || m.Inputs[rel] != key {
+		return false
+	}
+	found := false
+	for name, entry := range m.Files {
+		if !contains(entry.Sources, rel) {
+			continue
+		}
+		found = true
+		if hash, err := hashFile(filepath.Join(dir, filepath.FromSlash(name))); err != nil || hash != entry.SHA256 {
+			return false
+		}
+	}
+	return found
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheKey(t *testing.T) {
+	dir := newTestModule(t, "included")
+	target := testTarget(t, dir, "item.thrift")
+	key, err := cacheKey(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the settings set by Plan for the batch aren't inputs
+	planned := target
+	planned.IncludesGenerated, planned.MetadataGenerated, planned.hasService = true, true, true
+	if k, err := cacheKey(planned); err != nil || k != key {
+		t.Errorf("the key is changed by the settings of the batch: %v", err)
+	}
+
+	changed := target
+	changed.Options.JSConv = true
+	if k, err := cacheKey(changed); err != nil || k == key {
+		t.Errorf("the key isn't changed by the options: %v", err)
+	}
+
+	// the included files are inputs as well
+	if err := writeFile(filepath.Join(dir, "base.thrift"), "namespace go base\n"); err != nil {
+		t.Fatal(err)
+	}
+	if k, err := cacheKey(target); err != nil || k == key {
+		t.Errorf("the key isn't changed by the included file: %v", err)
+	}
+}
+
+func TestGenerateAllSkipsUnchanged(t *testing.T) {
+	dir := newTestModule(t, "included")
+	target := testTarget(t, dir, "item.thrift")
+	target.Recursive = true
+	generate := func() Result {
+		t.Helper()
+		targets, err := Plan([]Target{target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := GenerateAll(targets, 1, false, false)
+		if results[0].Err != nil {
+			t.Fatal(results[0].Err)
+		}
+		if _, err := Reconcile(ioutil.Discard, results, false); err != nil {
+			t.Fatal(err)
+		}
+		return results[0]
+	}
+
+	if generate().Skipped {
+		t.Fatal("the first generation is skipped")
+	}
+	if !generate().Skipped {
+		t.Error("the unchanged thrift file is generated again")
+	}
+
+	// a generated file changed by hand is generated again
+	handler := filepath.Join(dir, "gen", "item", "handler.gen.go")
+	if err := writeFile(handler, "package item\n"); err != nil {
+		t.Fatal(err)
+	}
+	if generate().Skipped {
+		t.Error("the thrift file with a changed generated file is skipped")
+	}
+	if data, err := ioutil.ReadFile(handler); err != nil || string(data) == "package item\n" {
+		t.Errorf("the changed generated file isn't restored: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	generator "github.com/sunyakun/thriftgo-tools"
+)
+
+// Check compares the files generated in memory with the ones on disk and writes the unified diff of every
+// drifted file to w, including the stale files to be removed, the diff applies to the working tree with
+// git apply. It returns the number of the drifted files.
+func Check(w io.Writer, results []Result, stale []string) (int, error) {
+	mains := make(map[string]bool)
+	for _, r := range results {
+		if r.Target.Main != "" {
+			mains[filepath.Clean(r.Target.Main)] = true
+		}
+	}
+
+	// every target adds its service to the main on disk, they're merged like the main written one by one
+	generated := make(map[string][]byte)
+	for _, r := range results {
+		for _, f := range r.Files {
+			name := filepath.Clean(f.Name)
+			if prev, ok := generated[name]; ok && mains[name] {
+				merged, err := generator.MergeMain(string(prev), string(f.Content))
+				if err != nil {
+					return 0, fmt.Errorf("%s: %w", name, err)
+				}
+				generated[name] = []byte(merged)
+				continue
+			}
+			generated[name] = f.Content
+		}
+	}
+	names := make([]string, 0, len(generated))
+	for name := range generated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	drifted := 0
+	for _, name := range names {
+		oldName := "a/" + filepath.ToSlash(name)
+		existing, err := ioutil.ReadFile(name)
+		if errors.Is(err, os.ErrNotExist) {
+			oldName = "/dev/null"
+		} else if err != nil {
+			return drifted, err
+		}
+		if diff := generator.UnifiedDiff(oldName, "b/"+filepath.ToSlash(name), existing, generated[name]); diff != "" {
+			drifted++
+			fmt.Fprint(w, diff)
+		}
+	}
+	for _, name := range stale {
+		existing, err := ioutil.ReadFile(name)
+		if err != nil {
+			return drifted, err
+		}
+		drifted++
+		fmt.Fprint(w, generator.UnifiedDiff("a/"+filepath.ToSlash(filepath.Clean(name)), "/dev/null", existing, nil))
+	}
+	return drifted, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	dir := newTestModule(t, "included")
+	target := testTarget(t, dir, "item.thrift")
+	target.Recursive = true
+	generate := func(target Target, dryRun bool) []Result {
+		t.Helper()
+		targets, err := Plan([]Target{target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := GenerateAll(targets, 1, dryRun, false)
+		if results[0].Err != nil {
+			t.Fatal(results[0].Err)
+		}
+		return results
+	}
+	check := func(target Target) (int, string) {
+		t.Helper()
+		results := generate(target, true)
+		stale, err := Reconcile(ioutil.Discard, results, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var diff strings.Builder
+		drifted, err := Check(&diff, results, stale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return drifted, diff.String()
+	}
+
+	// the files to be generated are new ones, nothing is written
+	if drifted, diff := check(target); drifted == 0 || !strings.Contains(diff, "--- /dev/null") {
+		t.Errorf("expect the new files, got %d:\n%s", drifted, diff)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gen")); !os.IsNotExist(err) {
+		t.Fatalf("the check writes the output: %v", err)
+	}
+
+	if _, err := Reconcile(ioutil.Discard, generate(target, false), false); err != nil {
+		t.Fatal(err)
+	}
+	if drifted, diff := check(target); drifted != 0 {
+		t.Errorf("expect nothing drifted, got %d:\n%s", drifted, diff)
+	}
+
+	// the generated file changed by hand drifts and isn't restored by the check
+	handler := filepath.Join(dir, "gen", "item", "handler.gen.go")
+	if err := writeFile(handler, "package item\n"); err != nil {
+		t.Fatal(err)
+	}
+	drifted, diff := check(target)
+	if drifted != 1 || !strings.Contains(diff, "--- a/"+filepath.ToSlash(handler)+"\n") {
+		t.Errorf("expect the handler drifted, got %d:\n%s", drifted, diff)
+	}
+	if data, err := ioutil.ReadFile(handler); err != nil || string(data) != "package item\n" {
+		t.Errorf("the check restores the handler: %v", err)
+	}
+
+	// the file no longer generated is to be removed
+	withoutRouter := target
+	withoutRouter.Router = ""
+	router := filepath.Join(dir, "gen", "item", "router.gen.go")
+	drifted, diff = check(withoutRouter)
+	if drifted != 2 || !strings.Contains(diff, "--- a/"+filepath.ToSlash(router)+"\n+++ /dev/null\n") {
+		t.Errorf("expect the router removed, got %d:\n%s", drifted, diff)
+	}
+	if _, err := os.Stat(router); err != nil {
+		t.Errorf("the check removes the router: %v", err)
+	}
+}
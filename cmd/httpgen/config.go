@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	generator "github.com/sunyakun/thriftgo-tools"
+)
+
+// ConfigFile is the file recording the generator settings of a project, httpgen reuses them
+// when it runs without a thrift file. The paths in it are relative to the working directory.
+const ConfigFile = "httpgen.yaml"
+
+// ConfigVersion is the version of the config schema.
+const ConfigVersion = 1
+
+// Config is the schema of the config file, the settings of an IDL in IDLs override the global ones.
+type Config struct {
+	Version     int         `yaml:"version,omitempty"`
+	Backend     string      `yaml:"backend,omitempty"`      // the builtin templates, like gin
+	TemplateDir string      `yaml:"template_dir,omitempty"` // the templates replacing the builtin ones of the backend
+	Module      string      `yaml:"module,omitempty"`
+	Prefix      string      `yaml:"prefix,omitempty"`
+	Output      string      `yaml:"output,omitempty"`
+	Handler     string      `yaml:"handler,omitempty"`
+	Router      string      `yaml:"router,omitempty"`
+	Service     string      `yaml:"service,omitempty"`
+	Main        string      `yaml:"main,omitempty"`
+	IR          string      `yaml:"ir,omitempty"` // the json intermediate representation for the custom templates
+	Options     Options     `yaml:"options,omitempty"`
+	IDLs        []IDLConfig `yaml:"idls"`
+}
+
+// Options are the plugin options and the feature toggles.
+type Options struct {
+	UploadMax  string `yaml:"upload_max,omitempty"`
+	JSConv     bool   `yaml:"js_conv,omitempty"`
+	Recursive  bool   `yaml:"recursive,omitempty"`
+	OTel       bool   `yaml:"otel,omitempty"`
+	Prometheus bool   `yaml:"prometheus,omitempty"`
+	RequestLog bool   `yaml:"request_log,omitempty"`
+}
+
+// IDLConfig is a thrift file to be generated, the empty settings are taken from the config.
+type IDLConfig struct {
+	Path    string `yaml:"path"`
+	Output  string `yaml:"output,omitempty"`
+	Prefix  string `yaml:"prefix,omitempty"`
+	Handler string `yaml:"handler,omitempty"`
+	Router  string `yaml:"router,omitempty"`
+	Service string `yaml:"service,omitempty"`
+	Main    string `yaml:"main,omitempty"`
+	IR      string `yaml:"ir,omitempty"`
+}
+
+// Target is the resolved settings of generating a thrift file.
+type Target struct {
+	IDL         string
+	Output      string
+	Module      string
+	Prefix      string
+	Handler     string
+	Router      string
+	Service     string
+	Main        string
+	IR          string
+	TemplateDir string
+	Options
+
+	// IncludesGenerated is set if the included files are generated as the other targets.
+	IncludesGenerated bool
+	// MetadataGenerated is set if the shared metadata package of the output directory is generated for the targets.
+	MetadataGenerated bool
+
+	hasService bool // the thrift file has a service, it's set by Plan
+}
+
+func LoadConfig(name string) (*Config, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	conf := &Config{}
+	if err := yaml.UnmarshalStrict(data, conf); err != nil {
+		// the go types are replaced by the keys in the file
+		msg := strings.NewReplacer("in type main.Config", "in the config", "in type main.Options", "in options",
+			"in type main.IDLConfig", "in idls").Replace(err.Error())
+		return nil, fmt.Errorf("invalid %s: %s", name, msg)
+	}
+	return conf, nil
+}
+
+func SaveConfig(name string, conf *Config) error {
+	data, err := yaml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+// Targets resolves the settings of every thrift file.
+func (c *Config) Targets() []Target {
+	pick := func(v, def string) string {
+		if v != "" {
+			return v
+		}
+		return def
+	}
+	targets := make([]Target, 0, len(c.IDLs))
+	for _, idl := range c.IDLs {
+		targets = append(targets, Target{
+			IDL:         idl.Path,
+			Output:      pick(idl.Output, c.Output),
+			Module:      c.Module,
+			Prefix:      pick(idl.Prefix, c.Prefix),
+			Handler:     pick(idl.Handler, c.Handler),
+			Router:      pick(idl.Router, c.Router),
+			Service:     pick(idl.Service, c.Service),
+			Main:        pick(idl.Main, c.Main),
+			IR:          pick(idl.IR, c.IR),
+			TemplateDir: c.templateDir(),
+			Options:     c.Options,
+		})
+	}
+	return targets
+}
+
+// Override replaces the settings with the flags which are set explicitly, the names of them are in set.
+// The settings of the thrift files are dropped as well, or they would take precedence over the flags.
+func (c *Config) Override(flags *Config, set map[string]bool) {
+	for name := range set {
+		switch name {
+		case "output":
+			c.Output = flags.Output
+		case "module":
+			c.Module = flags.Module
+		case "router":
+			c.Router = flags.Router
+		case "handler":
+			c.Handler = flags.Handler
+		case "service":
+			c.Service = flags.Service
+		case "main":
+			c.Main = flags.Main
+		case "ir":
+			c.IR = flags.IR
+		case "prefix":
+			c.Prefix = flags.Prefix
+		case "backend":
+			c.Backend = flags.Backend
+		case "template_dir":
+			c.TemplateDir = flags.TemplateDir
+		case "upload_max":
+			c.Options.UploadMax = flags.Options.UploadMax
+		case "js_conv":
+			c.Options.JSConv = flags.Options.JSConv
+		case "recursive":
+			c.Options.Recursive = flags.Options.Recursive
+		case "otel":
+			c.Options.OTel = flags.Options.OTel
+		case "prometheus":
+			c.Options.Prometheus = flags.Options.Prometheus
+		case "request_log":
+			c.Options.RequestLog = flags.Options.RequestLog
+		}
+	}
+	for i := range c.IDLs {
+		idl := &c.IDLs[i]
+		settings := map[string]*string{
+			"output":  &idl.Output,
+			"prefix":  &idl.Prefix,
+			"handler": &idl.Handler,
+			"router":  &idl.Router,
+			"service": &idl.Service,
+			"main":    &idl.Main,
+			"ir":      &idl.IR,
+		}
+		for name, v := range settings {
+			if set[name] {
+				*v = ""
+			}
+		}
+	}
+}
+
+func (c *Config) templateDir() string {
+	if c.TemplateDir != "" {
+		return c.TemplateDir
+	}
+	return path.Join("templates", c.backend())
+}
+
+func (c *Config) backend() string {
+	if c.Backend != "" {
+		return c.Backend
+	}
+	return "gin"
+}
+
+// Validate checks the config against the schema, every violation is reported with the path of the value.
+func (c *Config) Validate() error {
+	var violations []string
+	violate := func(field, format string, a ...interface{}) {
+		if v := field + ": " + fmt.Sprintf(format, a...); !contains(violations, v) {
+			violations = append(violations, v)
+		}
+	}
+	goFile := func(field, v string) {
+		if v != "" && !strings.HasSuffix(v, ".go") {
+			violate(field, "'%s' should be a .go file", v)
+		}
+	}
+	jsonFile := func(field, v string) {
+		if v != "" && !strings.HasSuffix(v, ".json") {
+			violate(field, "'%s' should be a .json file", v)
+		}
+	}
+
+	if c.Version != 0 && c.Version != ConfigVersion {
+		violate("version", "unsupported version %d, it should be %d", c.Version, ConfigVersion)
+	}
+	backends, err := fs.ReadDir(generator.Templates, "templates")
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(backends))
+	for _, b := range backends {
+		names = append(names, b.Name())
+	}
+	if !contains(names, c.backend()) {
+		violate("backend", "unknown backend '%s', it should be one of %s", c.Backend, strings.Join(names, ", "))
+	}
+	if fi, err := os.Stat(c.templateDir()); err != nil || !fi.IsDir() {
+		violate("template_dir", "'%s' is not a directory", c.templateDir())
+	} else if _, err := generator.LoadTemplateManifest(c.templateDir()); err != nil {
+		violate("template_dir", "%s", strings.ReplaceAll(err.Error(), "\n", "\n  "))
+	}
+	if c.Options.UploadMax != "" {
+		if _, err := generator.ParseSize(c.Options.UploadMax); err != nil {
+			violate("options.upload_max", "%v, it should be like 32MB", err)
+		}
+	}
+	goFile("handler", c.Handler)
+	goFile("router", c.Router)
+	goFile("service", c.Service)
+	goFile("main", c.Main)
+	jsonFile("ir", c.IR)
+
+	if len(c.IDLs) == 0 {
+		violate("idls", "no thrift file to generate")
+	}
+	paths := make([]string, 0, len(c.IDLs))
+	for i, idl := range c.IDLs {
+		field := fmt.Sprintf("idls[%d]", i)
+		switch {
+		case idl.Path == "":
+			violate(field+".path", "is required")
+		case !strings.HasSuffix(idl.Path, ".thrift"):
+			violate(field+".path", "'%s' should be a .thrift file", idl.Path)
+		case contains(paths, filepath.Clean(idl.Path)):
+			violate(field+".path", "'%s' is listed more than once", idl.Path)
+		default:
+			if _, err := os.Stat(idl.Path); errors.Is(err, os.ErrNotExist) {
+				violate(field+".path", "'%s' doesn't exist", idl.Path)
+			} else if err != nil {
+				violate(field+".path", "%v", err)
+			}
+		}
+		paths = append(paths, filepath.Clean(idl.Path))
+		goFile(field+".handler", idl.Handler)
+		goFile(field+".router", idl.Router)
+		goFile(field+".service", idl.Service)
+		goFile(field+".main", idl.Main)
+		jsonFile(field+".ir", idl.IR)
+	}
+
+	// the resolved settings are reported where they're set, once for the global ones
+	for i, t := range c.Targets() {
+		field := func(name, v string) string {
+			if v != "" {
+				return fmt.Sprintf("idls[%d].%s", i, name)
+			}
+			return name
+		}
+		if t.Output == "" {
+			violate("output", "is required, set it globally or for every thrift file")
+		}
+		if t.Main != "" && t.Service == "" {
+			violate(field("main", c.IDLs[i].Main), "the main registers the generated service, service is required")
+		}
+		if t.Main != "" && t.Module == "" && t.Prefix == "" {
+			violate(field("main", c.IDLs[i].Main), "the main imports the generated package, module or prefix is required")
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(violations, "\n  "))
+	}
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestOverrideIDLSettings(t *testing.T) {
+	conf := &Config{
+		Output:  "gen",
+		Handler: "handler.go",
+		Router:  "router.go",
+		IDLs: []IDLConfig{
+			{Path: "a.thrift", Handler: "a_handler.go", Router: "a_router.go"},
+			{Path: "b.thrift"},
+		},
+	}
+
+	var flags Config
+	fs := flag.NewFlagSet("httpgen", flag.ContinueOnError)
+	fs.StringVar(&flags.Handler, "handler", "", "")
+	fs.StringVar(&flags.Router, "router", "", "")
+	fs.BoolVar(&flags.Options.OTel, "otel", false, "")
+	if err := fs.Parse([]string{"-handler", "flag_handler.go", "-otel"}); err != nil {
+		t.Fatal(err)
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	conf.Override(&flags, set)
+
+	targets := conf.Targets()
+	if len(targets) != 2 {
+		t.Fatalf("expect 2 targets, got %d", len(targets))
+	}
+	for _, target := range targets {
+		if target.Handler != "flag_handler.go" {
+			t.Errorf("%s: the handler set by the flag is overridden by '%s'", target.IDL, target.Handler)
+		}
+		if !target.OTel {
+			t.Errorf("%s: the option set by the flag is missing", target.IDL)
+		}
+	}
+	// the settings without flags are kept
+	if targets[0].Router != "a_router.go" || targets[1].Router != "router.go" {
+		t.Errorf("the routers without the flag are changed: '%s', '%s'", targets[0].Router, targets[1].Router)
+	}
+}
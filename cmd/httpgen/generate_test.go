@@ -0,0 +1,413 @@
+package main
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	generator "github.com/sunyakun/thriftgo-tools"
+)
+
+// testModule is the module the code is generated in by the tests, it requires the dependencies of this one.
+const testModule = "gentest"
+
+// builtinTemplates is the directory of the builtin templates of gin.
+var builtinTemplates = filepath.Join("..", "..", "templates", "gin")
+
+// newTestModule copies the directories in testdata into a go module in a temporary directory and returns
+// the directory. The thrift files and the tests of the generated code are in the directories.
+func newTestModule(t *testing.T, testdata ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is required to build the generated code")
+	}
+	dir := t.TempDir()
+	gomod, err := ioutil.ReadFile(filepath.Join("..", "..", "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gomod = regexp.MustCompile(`(?m)^module .*$`).ReplaceAll(gomod, []byte("module "+testModule))
+	gosum, err := ioutil.ReadFile(filepath.Join("..", "..", "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(dir, "go.mod"), string(gomod)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(dir, "go.sum"), string(gosum)); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range testdata {
+		copyDir(t, filepath.Join("testdata", name), dir)
+	}
+	return dir
+}
+
+// copyDir copies the files in src into dst, the existing files are overwritten.
+func copyDir(t *testing.T, src, dst string) {
+	t.Helper()
+	err := filepath.WalkDir(src, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return writeFile(filepath.Join(dst, rel), string(data))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testTarget returns the target generating the thrift file of the module into its gen directory with the
+// builtin templates of gin, the handler and the router are generated.
+func testTarget(t *testing.T, dir, idl string) Target {
+	t.Helper()
+	templateDir, err := filepath.Abs(builtinTemplates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Target{
+		IDL:         filepath.Join(dir, idl),
+		Output:      filepath.Join(dir, "gen"),
+		Prefix:      testModule + "/gen",
+		Handler:     "handler.gen.go",
+		Router:      "router.gen.go",
+		TemplateDir: templateDir,
+	}
+}
+
+// goCommand runs the go command in the module, the modules missing from go.mod are resolved as usual.
+func goCommand(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+// requireModules adds the modules the generated code requires besides the ones of this module, the test is
+// skipped if they can't be downloaded.
+func requireModules(t *testing.T, dir string, modules ...string) {
+	t.Helper()
+	if len(modules) == 0 {
+		return
+	}
+	cmd := exec.Command("go", append([]string{"get"}, modules...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("modules %s are not available: %v\n%s", strings.Join(modules, " "), err, out)
+	}
+}
+
+var (
+	otelModules = []string{"go.opentelemetry.io/otel@v1.28.0", "go.opentelemetry.io/otel/sdk@v1.28.0",
+		"go.opentelemetry.io/otel/sdk/metric@v1.28.0"}
+	prometheusModules = []string{"github.com/prometheus/client_golang@v1.19.0"}
+)
+
+// TestGenerate generates the thrift file of a testdata directory and runs the tests of the directory against
+// the generated code.
+func TestGenerate(t *testing.T) {
+	cases := []struct {
+		name     string
+		testdata string
+		idl      string
+		setup    func(target *Target)
+		modules  []string
+		wantErr  string // the generation fails with the error instead
+	}{
+		{
+			name:     "included structs need recursive mode",
+			testdata: "included",
+			idl:      "item.thrift",
+			wantErr:  "recursive mode",
+		},
+		{
+			name:     "included structs",
+			testdata: "included",
+			idl:      "item.thrift",
+			setup:    func(target *Target) { target.Recursive = true },
+		},
+		{
+			name:     "response headers, cookies and status",
+			testdata: "response",
+			idl:      "resp.thrift",
+		},
+		{
+			name:     "file upload and download",
+			testdata: "file",
+			idl:      "file.thrift",
+		},
+		{
+			name:     "inherited functions",
+			testdata: "extends",
+			idl:      "ext.thrift",
+			setup:    func(target *Target) { target.Recursive = true },
+		},
+		{
+			name:     "non-struct responses",
+			testdata: "nonstruct",
+			idl:      "ns.thrift",
+			setup:    func(target *Target) { target.Recursive = true },
+		},
+		{
+			name:     "violations of every stage",
+			testdata: "violations",
+			idl:      "search.thrift",
+		},
+		{
+			name:     "oneway calls drained on shutdown",
+			testdata: "oneway",
+			idl:      "ow.thrift",
+			setup: func(target *Target) {
+				target.Service, target.Main = "service.go", filepath.Join(target.Output, "..", "server", "main.go")
+			},
+		},
+		{
+			name:     "middlewares inside the metrics and the log",
+			testdata: "middleware",
+			idl:      "mw.thrift",
+			setup:    func(target *Target) { target.Prometheus, target.RequestLog = true, true },
+			modules:  prometheusModules,
+		},
+		{
+			name:     "redacted response log",
+			testdata: "redact",
+			idl:      "rd.thrift",
+			setup:    func(target *Target) { target.RequestLog = true },
+		},
+		{
+			name:     "otel status",
+			testdata: "otel",
+			idl:      "ot.thrift",
+			setup:    func(target *Target) { target.OTel = true },
+			modules:  otelModules,
+		},
+		{
+			name:     "prometheus status",
+			testdata: "prometheus",
+			idl:      "pm.thrift",
+			setup:    func(target *Target) { target.Prometheus = true },
+			modules:  prometheusModules,
+		},
+		{
+			name:     "metadata in the package",
+			testdata: "metadata",
+			idl:      "md.thrift",
+			setup:    func(target *Target) { target.Prefix = "" },
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := newTestModule(t, c.testdata)
+			requireModules(t, dir, c.modules...)
+			target := testTarget(t, dir, c.idl)
+			if c.setup != nil {
+				c.setup(&target)
+			}
+			var stderr strings.Builder
+			err := Generate(target, &stderr)
+			if stderr.Len() > 0 {
+				t.Log(stderr.String())
+			}
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("expect an error of '%s', got %v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the packages without tests, like the generated main, are built by vet
+			goCommand(t, dir, "vet", "./...")
+			goCommand(t, dir, "test", "./...")
+		})
+	}
+}
+
+func TestGenerateUnusedIncluded(t *testing.T) {
+	dir := newTestModule(t, "unused")
+	// the included file is generated on its own, the structs of it are patched there
+	included := testTarget(t, dir, "audit.thrift")
+	included.Handler, included.Router, included.JSConv = "", "", true
+	if err := Generate(included, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	target := testTarget(t, dir, "note.thrift")
+	target.JSConv = true
+	var stderr strings.Builder
+	if err := Generate(target, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr.String(), "annotations of the structs in the included") {
+		t.Errorf("expect a warning of the skipped annotations, got:\n%s", stderr.String())
+	}
+	goCommand(t, dir, "vet", "./gen/...")
+}
+
+func TestGenerateAllSharedMetadata(t *testing.T) {
+	dir := newTestModule(t, "otel", "prometheus")
+	targets, err := Plan([]Target{testTarget(t, dir, "ot.thrift"), testTarget(t, dir, "pm.thrift")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := filepath.Join(dir, "gen", "httpmeta", "httpmeta.go")
+	for _, r := range GenerateAll(targets, 2, false, false) {
+		if r.Err != nil {
+			t.Fatalf("%s: %v", r.Target.IDL, r.Err)
+		}
+		// the shared file is generated once and recorded for every target
+		recorded := 0
+		for _, f := range r.Files {
+			if filepath.Clean(f.Name) == metadata {
+				recorded++
+			}
+		}
+		if recorded != 1 {
+			t.Errorf("%s: the shared metadata is recorded %d times", r.Target.IDL, recorded)
+		}
+	}
+	goCommand(t, dir, "build", "./...")
+
+	// the targets of the batch don't write the shared file themselves
+	shared := targets[0]
+	shared.MetadataGenerated = true
+	files, err := GenerateFiles(shared, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if filepath.Clean(f.Name) == metadata {
+			t.Errorf("the shared metadata is generated by %s", shared.IDL)
+		}
+	}
+}
+
+func TestGenerateIR(t *testing.T) {
+	dir := newTestModule(t, "ir")
+	target := testTarget(t, dir, "stream.thrift")
+	target.IR = "ir.json"
+	if err := Generate(target, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "gen", "stream", "ir.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the IR doesn't leak the go expressions of the builtin templates
+	for _, expr := range []string{"resp.", "req.", "httpmeta", `\"`} {
+		if strings.Contains(string(data), expr) {
+			t.Errorf("the IR has the go expression %s:\n%s", expr, data)
+		}
+	}
+	ir, err := generator.LoadIR(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ir.Services) != 1 || len(ir.Services[0].Routes) != 2 {
+		t.Fatalf("unexpected services: %+v", ir.Services)
+	}
+	get, touch := ir.Services[0].Routes[0], ir.Services[0].Routes[1]
+	if get.Timeout != "1.5s" || get.Request.Schema != "stream.GetReq" ||
+		len(get.Request.Params) != 1 || get.Request.Params[0] != (generator.IRParam{Field: "id", Name: "id", In: "path", Rule: "$>0"}) {
+		t.Errorf("unexpected request of get: %+v", get)
+	}
+	resp := get.Response
+	if resp == nil || resp.Type != "stream.Download" || resp.Stream == nil ||
+		*resp.Stream != (generator.IRStream{Field: "data", ContentType: "text/plain"}) ||
+		len(resp.Fields) != 1 || resp.Fields[0] != (generator.IRResponseField{Field: "etag", Name: "ETag", In: "header"}) {
+		t.Errorf("unexpected response of get: %+v", resp)
+	}
+	if touch.Response != nil || touch.Timeout != "" {
+		t.Errorf("unexpected oneway route: %+v", touch)
+	}
+	// the types of the fields are named like the ones of the routes
+	types := make(map[string]string)
+	for _, s := range ir.Structs {
+		for _, f := range s.Fields {
+			types[s.Name+"."+f.Name] = f.Type
+		}
+	}
+	if types["stream.Download.tags"] != "list<string>" || types["stream.Download.source"] != "stream.GetReq" {
+		t.Errorf("unexpected types of the fields: %v", types)
+	}
+
+	generateds, err := generator.NewGenerator().Render(ir, filepath.Join(dir, "templates"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "GET /streams/:id\nPOST /streams/:id/touch\n"
+	if len(generateds) != 1 || generateds[0].GetName() != "routes.txt" || generateds[0].GetContent() != want {
+		t.Errorf("unexpected rendered files: %+v", generateds)
+	}
+
+	// the builtin templates and the ones per service are skipped when they're rendered along with the ones
+	// of the IR
+	templateDir := filepath.Join(dir, "builtin")
+	copyDir(t, builtinTemplates, templateDir)
+	copyDir(t, filepath.Join(dir, "templates"), templateDir)
+	manifest := "outputs:\n  - template: client.tmpl\n    path: \"{{ .PkgName }}/client.go\"\n"
+	if err := writeFile(filepath.Join(templateDir, generator.TemplateManifestFile), manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(templateDir, "client.tmpl"), "package {{ .PkgName }} // {{ .ServiceName }}\n"); err != nil {
+		t.Fatal(err)
+	}
+	generateds, err = generator.NewGenerator().Render(ir, templateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generateds) != 1 || generateds[0].GetName() != "routes.txt" || generateds[0].GetContent() != want {
+		t.Errorf("unexpected rendered files of the builtin templates: %+v", generateds)
+	}
+}
+
+func TestGenerateBuiltinOutputs(t *testing.T) {
+	dir := newTestModule(t, "prometheus")
+	templateDir := filepath.Join(dir, "tpl")
+	copyDir(t, builtinTemplates, templateDir)
+	copyDir(t, filepath.Join("testdata", "builtin"), templateDir)
+	// the skipped builtin output doesn't need its template
+	if err := os.Remove(filepath.Join(templateDir, "service.tmpl")); err != nil {
+		t.Fatal(err)
+	}
+
+	target := testTarget(t, dir, "pm.thrift")
+	target.Service, target.TemplateDir = "service.go", templateDir
+	if err := Generate(target, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	// the handler is renamed, the service is skipped and the router is generated per file from the IR
+	for name, exist := range map[string]bool{
+		"pm/api.gen.go":     true,
+		"pm/handler.gen.go": false,
+		"pm/router.gen.go":  false,
+		"pm/service.go":     false,
+		"pm.routes.txt":     true,
+	} {
+		if _, err := os.Stat(filepath.Join(dir, "gen", name)); (err == nil) != exist {
+			t.Errorf("%s: expect existing %v, got %v", name, exist, err)
+		}
+	}
+	routes, err := ioutil.ReadFile(filepath.Join(dir, "gen", "pm.routes.txt"))
+	if err != nil || string(routes) != "GET /pm/:id\n" {
+		t.Errorf("unexpected routes %q: %v", routes, err)
+	}
+	goCommand(t, dir, "vet", "./gen/...")
+}
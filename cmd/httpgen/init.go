@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+
+	generator "github.com/sunyakun/thriftgo-tools"
+)
+
+//go:embed scaffold
+var scaffold embed.FS
+
+// scaffoldDesc is the data of the scaffold templates.
+type scaffoldDesc struct {
+	Version    string
+	Module     string
+	GoVersion  string // the go directive of go.mod, the generated code may use the packages like log/slog
+	Name       string // the thrift namespace and go package of the starter service, like todo
+	TypeName   string // the name of the starter struct, like Todo
+	ConfigFile string
+	MainDir    string
+}
+
+// scaffoldFiles are the files created by init and the scaffold templates of them.
+var scaffoldFiles = []struct {
+	name     string
+	template string
+}{
+	{"go.mod", "scaffold/go.mod.tmpl"},
+	{"idl/{{ .Name }}.thrift", "scaffold/idl.thrift.tmpl"},
+	{"Makefile", "scaffold/Makefile.tmpl"},
+}
+
+// InitMode creates a project in the directory with a starter thrift file, the generator settings are
+// recorded in the config file, then the code of the project is generated.
+func InitMode(args []string) {
+	var (
+		module string
+		name   string
+	)
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	flags.StringVar(&module, "module", "", "module path of the project, like github.com/acme/todo")
+	flags.StringVar(&name, "name", "", "name of the starter service, the default is the last element of the module path")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: httpgen init -module <module> [-name <name>] [dir]\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	dir := "."
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+	if module == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if name == "" {
+		name = path.Base(module)
+	}
+
+	conf, err := initProject(dir, module, name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// the paths in the config are relative to the project
+	if err := os.Chdir(dir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := conf.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// the generated files are recorded in the manifest like the later generations do
+	targets, err := Plan(conf.Targets())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	results := GenerateAll(targets, 1, false, false)
+	for _, r := range results {
+		os.Stderr.Write(r.Output)
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", r.Target.IDL, r.Err)
+			os.Exit(1)
+		}
+	}
+	if _, err := Reconcile(os.Stderr, results, false); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("project %s is created in %s, run 'go mod tidy' to add the dependencies\n", module, dir)
+}
+
+func initProject(dir, module, name string) (*Config, error) {
+	name = strings.ToLower(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	if typeName(name) == "" || !isIdentifier(name) {
+		return nil, fmt.Errorf("invalid service name '%s'", name)
+	}
+	desc := scaffoldDesc{
+		Version:    generator.Version,
+		Module:     module,
+		GoVersion:  goVersion(),
+		Name:       name,
+		TypeName:   typeName(name),
+		ConfigFile: ConfigFile,
+		MainDir:    "cmd/server",
+	}
+
+	for _, existing := range []string{ConfigFile, "go.mod"} {
+		if _, err := os.Stat(filepath.Join(dir, existing)); err == nil {
+			return nil, fmt.Errorf("%s exists in %s, the project is already initialized", existing, dir)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	for _, f := range scaffoldFiles {
+		fileName, err := execute(f.name, f.name, desc)
+		if err != nil {
+			return nil, err
+		}
+		text, err := scaffold.ReadFile(f.template)
+		if err != nil {
+			return nil, err
+		}
+		content, err := execute(f.template, string(text), desc)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFile(filepath.Join(dir, fileName), content); err != nil {
+			return nil, err
+		}
+	}
+
+	// the builtin templates are copied so that the project can customize them
+	templateDir := "templates"
+	err := fs.WalkDir(generator.Templates, "templates", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := generator.Templates.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return writeFile(filepath.Join(dir, filepath.FromSlash(name)), string(data))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &Config{
+		Version:     ConfigVersion,
+		Backend:     "gin",
+		TemplateDir: templateDir + "/gin",
+		Prefix:      module + "/http_gen",
+		Output:      "http_gen",
+		Handler:     "handler.gen.go",
+		Router:      "router.gen.go",
+		Service:     "service.go",
+		Main:        desc.MainDir + "/main.go",
+		IDLs:        []IDLConfig{{Path: "idl/" + name + ".thrift"}},
+	}
+	if err := SaveConfig(filepath.Join(dir, ConfigFile), conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// minGoVersion is the least go version of the generated code, the request log uses log/slog of go 1.21.
+const minGoVersion = 21
+
+// goVersion returns the language version of the running go toolchain like 1.22, or 1.21 if it's older or
+// unknown, like a development build.
+func goVersion() string {
+	minor := 0
+	if v := strings.TrimPrefix(runtime.Version(), "go1."); v != runtime.Version() {
+		minor, _ = strconv.Atoi(strings.SplitN(v, ".", 2)[0])
+	}
+	if minor < minGoVersion {
+		minor = minGoVersion
+	}
+	return fmt.Sprintf("1.%d", minor)
+}
+
+func execute(name, text string, data interface{}) (string, error) {
+	tpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func writeFile(name, content string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, []byte(content), 0644)
+}
+
+func isIdentifier(name string) bool {
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// typeName converts a snake case name to the camel case, like foo_bar to FooBar.
+func typeName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitRequestLog(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is required to build the generated code")
+	}
+	dir := t.TempDir()
+	conf, err := initProject(dir, testModule, "todo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gomod, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(gomod), "\ngo "+goVersion()+"\n") {
+		t.Errorf("unexpected go directive:\n%s", gomod)
+	}
+
+	// the paths in the config are relative to the project
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	conf.Options.RequestLog = true
+	targets, err := Plan(conf.Targets())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range GenerateAll(targets, 1, false, false) {
+		if r.Err != nil {
+			t.Fatalf("%s: %v", r.Target.IDL, r.Err)
+		}
+	}
+	goCommand(t, dir, "vet", "./...")
+}
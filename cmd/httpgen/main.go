@@ -6,9 +6,11 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/cloudwego/thriftgo/plugin"
 
@@ -32,6 +34,24 @@ func ParsePluginArgs(args []string, gargs []string) *generator.Args {
 				a.Module = v
 			case "template_dir":
 				a.TemplateDir = v
+			case "upload_max":
+				a.MaxUploadSize = v
+			case "js_conv":
+				a.JSConv = v == "true"
+			case "otel":
+				a.OTel = v == "true"
+			case "prometheus":
+				a.Prometheus = v == "true"
+			case "request_log":
+				a.RequestLog = v == "true"
+			case "main":
+				a.MainPath = v
+			case "ir":
+				a.IRPath = v
+			case "includes_generated":
+				a.IncludesGenerated = v == "true"
+			case "metadata_generated":
+				a.MetadataGenerated = v == "true"
 			}
 		}
 	}
@@ -75,28 +95,157 @@ func PluginMode() {
 	_, _ = os.Stdout.Write(rb)
 }
 
-func ProgramMode(pluginPath string) {
+func ProgramMode() {
 	var (
-		outputPath    string
-		module        string
-		routerPath    string
-		handlerPath   string
-		servicePath   string
-		packagePrefix string
-		templateDir   string
-		thriftFile    string
+		configFile string
+		jobs       int
+		check      bool
+		diff       bool
+		watch      bool
+		run        string
+		force      bool
+		flags      Config
 	)
-
-	flag.StringVar(&outputPath, "output", "", "output path")
-	flag.StringVar(&module, "module", "", "module name")
-	flag.StringVar(&routerPath, "router", "", "router file path")
-	flag.StringVar(&handlerPath, "handler", "", "handler file path")
-	flag.StringVar(&servicePath, "service", "", "service file path")
-	flag.StringVar(&packagePrefix, "prefix", "", "package prefix")
-	flag.StringVar(&templateDir, "template_dir", "", "code template directory")
-	thriftFile = os.Args[len(os.Args)-1]
+	flag.StringVar(&configFile, "config", ConfigFile, "config file, the flags override the settings in it")
+	flag.IntVar(&jobs, "jobs", runtime.NumCPU(), "number of the thrift files generated concurrently")
+	flag.BoolVar(&check, "check", false, "generate in memory and fail with the diff if the generated files are stale, nothing is written")
+	flag.BoolVar(&diff, "diff", false, "generate in memory and print the diff of the stale generated files, nothing is written")
+	flag.BoolVar(&force, "force", false, "generate the thrift files even if they're unchanged since the last generation")
+	flag.BoolVar(&watch, "watch", false, "regenerate whenever the thrift files, the included ones or the templates change")
+	flag.StringVar(&run, "run", "", "command run after every successful generation of -watch, the previous run is stopped first, like 'go run ./cmd/server'")
+	flag.StringVar(&flags.Output, "output", "", "output path")
+	flag.StringVar(&flags.Module, "module", "", "module name")
+	flag.StringVar(&flags.Router, "router", "", "router file path")
+	flag.StringVar(&flags.Handler, "handler", "", "handler file path")
+	flag.StringVar(&flags.Service, "service", "", "service file path")
+	flag.StringVar(&flags.Main, "main", "", "server main file path, the service is added to it if it exists")
+	flag.StringVar(&flags.IR, "ir", "", "json file path of the intermediate representation, render templates from it by 'httpgen render'")
+	flag.StringVar(&flags.Prefix, "prefix", "", "package prefix")
+	flag.StringVar(&flags.Backend, "backend", "", "builtin templates, the default is gin")
+	flag.StringVar(&flags.TemplateDir, "template_dir", "", "code template directory")
+	flag.StringVar(&flags.Options.UploadMax, "upload_max", "", "default size limit of an uploaded file, like 32MB")
+	flag.BoolVar(&flags.Options.JSConv, "js_conv", false, "encode all the i64 fields as json strings")
+	flag.BoolVar(&flags.Options.Recursive, "recursive", false, "generate the included thrift files too")
+	flag.BoolVar(&flags.Options.OTel, "otel", false, "instrument the handlers with opentelemetry tracing and metrics")
+	flag.BoolVar(&flags.Options.Prometheus, "prometheus", false, "wrap the routes with prometheus collectors")
+	flag.BoolVar(&flags.Options.RequestLog, "request_log", false, "log the requests and responses by log/slog with the sensitive fields redacted")
 	flag.Parse()
 
+	// the config file is optional unless it's given explicitly or there's no thrift file in the arguments
+	conf, loaded := &Config{}, false
+	explicit := false
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "config" })
+	if _, err := os.Stat(configFile); err == nil || explicit || flag.NArg() == 0 {
+		if conf, err = LoadConfig(configFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		loaded = true
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	conf.Override(&flags, set)
+	// the thrift files in the arguments replace the ones in the config, so do their settings
+	if flag.NArg() > 0 {
+		conf.IDLs = make([]IDLConfig, 0, flag.NArg())
+		for _, arg := range flag.Args() {
+			conf.IDLs = append(conf.IDLs, IDLConfig{Path: arg})
+		}
+	}
+	idls, err := ExpandIDLs(conf.IDLs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	conf.IDLs = idls
+	if err := conf.Validate(); err != nil {
+		if loaded {
+			err = fmt.Errorf("%s: %w", configFile, err)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if run != "" && !watch {
+		fmt.Fprintln(os.Stderr, "-run works with -watch only")
+		os.Exit(2)
+	}
+	if watch && (check || diff) {
+		fmt.Fprintln(os.Stderr, "-watch doesn't work with -check or -diff")
+		os.Exit(2)
+	}
+	if watch {
+		Watch(os.Stderr, conf.Targets(), jobs, run)
+		return
+	}
+
+	targets, err := Plan(conf.Targets())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	dryRun := check || diff
+	if err := WarnEdited(os.Stderr, targets); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var results []Result
+	failed := 0
+	if len(targets) == 1 {
+		t := targets[0]
+		r := generateTarget(t, loadManifests(targets)[filepath.Clean(t.Output)], dryRun, force, os.Stderr)
+		if r.Err != nil {
+			fmt.Fprintln(os.Stderr, r.Err)
+			os.Exit(1)
+		}
+		if r.Skipped {
+			fmt.Fprintf(os.Stderr, "%s is unchanged since the last generation, use -force to generate it\n", t.IDL)
+		}
+		results = []Result{r}
+	} else {
+		start := time.Now()
+		results = GenerateAll(targets, jobs, dryRun, force)
+		failed = Summarize(os.Stderr, results, dryRun, time.Since(start))
+	}
+
+	// the files of the successful thrift files are recorded even if the others failed
+	stale, err := Reconcile(os.Stderr, results, dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+	if !dryRun {
+		return
+	}
+
+	drifted, err := Check(os.Stdout, results, stale)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if drifted > 0 {
+		fmt.Fprintf(os.Stderr, "%d generated files are out of date, run httpgen without -check to regenerate them\n", drifted)
+		if check {
+			os.Exit(1)
+		}
+	}
+}
+
+// Generate runs thriftgo in process with the plugin to generate the code of the thrift file in conf,
+// the warnings go to stderr.
+func Generate(conf Target, stderr io.Writer) error {
+	files, err := GenerateFiles(conf, stderr)
+	if err != nil {
+		return err
+	}
+	return WriteFiles(files)
+}
+
+// GenerateFiles generates the code of the thrift file in conf without writing it.
+func GenerateFiles(conf Target, stderr io.Writer) ([]File, error) {
 	empty := func(val, name string) error {
 		if val == "" {
 			return fmt.Errorf("%s is empty", name)
@@ -104,46 +253,59 @@ func ProgramMode(pluginPath string) {
 		return nil
 	}
 
-	if err := empty(outputPath, "output"); err != nil {
-		panic(err)
+	if err := empty(conf.Output, "output"); err != nil {
+		return nil, err
 	}
 
-	thriftgoArgs := []string{"-o", outputPath, "-g"}
-	if packagePrefix != "" {
-		thriftgoArgs = append(thriftgoArgs, "go:package_prefix="+packagePrefix)
-	} else {
-		thriftgoArgs = append(thriftgoArgs, "go")
+	lang := "go"
+	if conf.Prefix != "" {
+		lang = "go:package_prefix=" + conf.Prefix
 	}
 
 	pluginArgs := []string{}
-	if routerPath != "" {
-		pluginArgs = append(pluginArgs, "router="+routerPath)
+	if conf.Router != "" {
+		pluginArgs = append(pluginArgs, "router="+conf.Router)
 	}
-	if handlerPath != "" {
-		pluginArgs = append(pluginArgs, "handler="+handlerPath)
+	if conf.Handler != "" {
+		pluginArgs = append(pluginArgs, "handler="+conf.Handler)
 	}
-	if servicePath != "" {
-		pluginArgs = append(pluginArgs, "service="+servicePath)
+	if conf.Service != "" {
+		pluginArgs = append(pluginArgs, "service="+conf.Service)
 	}
-	if module != "" {
-		pluginArgs = append(pluginArgs, "module="+module)
+	if conf.Main != "" {
+		pluginArgs = append(pluginArgs, "main="+conf.Main)
 	}
-	if templateDir != "" {
-		pluginArgs = append(pluginArgs, "template_dir="+templateDir)
+	if conf.IR != "" {
+		pluginArgs = append(pluginArgs, "ir="+conf.IR)
 	}
-	thriftgoArgs = append(thriftgoArgs, "--plugin", "plugin="+pluginPath+":"+strings.Join(pluginArgs, ","))
-	thriftgoArgs = append(thriftgoArgs, thriftFile)
-
-	cmd := exec.Command("thriftgo", thriftgoArgs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		if exitErr, ok := err.(*exec.ExitError); !ok {
-			panic(err)
-		} else {
-			os.Exit(exitErr.ExitCode())
-		}
+	if conf.Module != "" {
+		pluginArgs = append(pluginArgs, "module="+conf.Module)
+	}
+	if conf.TemplateDir != "" {
+		pluginArgs = append(pluginArgs, "template_dir="+conf.TemplateDir)
 	}
+	if conf.UploadMax != "" {
+		pluginArgs = append(pluginArgs, "upload_max="+conf.UploadMax)
+	}
+	if conf.JSConv {
+		pluginArgs = append(pluginArgs, "js_conv=true")
+	}
+	if conf.OTel {
+		pluginArgs = append(pluginArgs, "otel=true")
+	}
+	if conf.Prometheus {
+		pluginArgs = append(pluginArgs, "prometheus=true")
+	}
+	if conf.RequestLog {
+		pluginArgs = append(pluginArgs, "request_log=true")
+	}
+	if conf.IncludesGenerated {
+		pluginArgs = append(pluginArgs, "includes_generated=true")
+	}
+	if conf.MetadataGenerated {
+		pluginArgs = append(pluginArgs, "metadata_generated=true")
+	}
+	return runThriftgo(conf.IDL, conf.Output, conf.Recursive, lang, pluginName+":"+strings.Join(pluginArgs, ","), stderr)
 }
 
 func main() {
@@ -152,29 +314,19 @@ func main() {
 		panic(err)
 	}
 
-	if strings.HasSuffix(path.Base(executable), "plugin") {
+	// thriftgo runs httpgen as a plugin if it's installed like thrift-gen-httpgen
+	if name := path.Base(executable); strings.HasSuffix(name, "plugin") || strings.HasPrefix(name, "thrift-gen-") {
 		PluginMode()
 		return
 	}
 
-	executableDir := path.Dir(executable)
-	pluginPath := path.Join(executableDir, "thriftgo-http-plugin")
-	if fileInfo, err := os.Stat(pluginPath); err != nil || fileInfo.IsDir() {
-		if err != nil {
-			pluginProgram, err := os.OpenFile(pluginPath, os.O_CREATE|os.O_WRONLY, 0755)
-			if err != nil {
-				panic(err)
-			}
-			currentProgram, err := os.Open(executable)
-			if err != nil {
-				panic(err)
-			}
-			if _, err := io.Copy(pluginProgram, currentProgram); err != nil {
-				panic(err)
-			}
-		} else if fileInfo.IsDir() {
-			panic(fmt.Errorf("%s is a directory", pluginPath))
-		}
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		InitMode(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		RenderMode(os.Args[2:])
+		return
 	}
-	ProgramMode(pluginPath)
+	ProgramMode()
 }
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	generator "github.com/sunyakun/thriftgo-tools"
+)
+
+// ManifestFile records the files generated into an output directory, the stale ones are removed by the
+// next generation. The paths in it are relative to the output directory.
+const ManifestFile = ".httpgen-manifest.json"
+
+// ManifestVersion is the version of the manifest schema.
+const ManifestVersion = 1
+
+type Manifest struct {
+	Version   int                       `json:"version"`
+	Generator string                    `json:"generator"`
+	Files     map[string]*ManifestEntry `json:"files"`
+	Inputs    map[string]string         `json:"inputs,omitempty"` // the thrift file => the cache key of its inputs
+}
+
+// ManifestEntry is a generated file, it's stale once no thrift file generates it.
+type ManifestEntry struct {
+	SHA256    string   `json:"sha256"`
+	Sources   []string `json:"sources"` // the thrift files generating it
+	DoNotEdit bool     `json:"do_not_edit,omitempty"`
+}
+
+// LoadManifest loads the manifest of the output directory, it's empty if the directory has none.
+func LoadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{Version: ManifestVersion, Files: make(map[string]*ManifestEntry), Inputs: make(map[string]string)}
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Join(dir, ManifestFile), err)
+	}
+	if m.Version != ManifestVersion {
+		return nil, fmt.Errorf("%s: unsupported version %d, it should be %d", filepath.Join(dir, ManifestFile),
+			m.Version, ManifestVersion)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]*ManifestEntry)
+	}
+	if m.Inputs == nil {
+		m.Inputs = make(map[string]string)
+	}
+	return m, nil
+}
+
+func (m *Manifest) Save(dir string) error {
+	m.Version, m.Generator = ManifestVersion, generator.Version
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, ManifestFile), string(data)+"\n")
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the hash of the file, it's empty if the file doesn't exist.
+func hashFile(name string) (string, error) {
+	data, err := ioutil.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return hashContent(data), nil
+}
+
+// isDoNotEdit reports whether the generated file shouldn't be edited by hand, like the handlers and the
+// thriftgo output, rather than the router and the service which keep the changes outside the generated blocks.
+func isDoNotEdit(content []byte) bool {
+	line := content
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		line = content[:i]
+	}
+	return bytes.HasPrefix(line, []byte("// Code generated")) && bytes.Contains(line, []byte("DO NOT EDIT"))
+}
+
+// relPath returns the path of name relative to the output directory.
+func relPath(dir, name string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, absName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// outputDirs returns the output directories of the targets.
+func outputDirs(targets []Target) []string {
+	dirs := make([]string, 0, 1)
+	for _, t := range targets {
+		if dir := filepath.Clean(t.Output); !contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// WarnEdited warns about the DO NOT EDIT files in the output directories of the targets which are changed
+// since they're generated, the changes are overwritten by the generation.
+func WarnEdited(w io.Writer, targets []Target) error {
+	for _, dir := range outputDirs(targets) {
+		m, err := LoadManifest(dir)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(m.Files))
+		for name := range m.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !m.Files[name].DoNotEdit {
+				continue
+			}
+			file := filepath.Join(dir, filepath.FromSlash(name))
+			if hash, err := hashFile(file); err != nil {
+				return err
+			} else if hash != "" && hash != m.Files[name].SHA256 {
+				fmt.Fprintf(w, "[WARN] %s is edited by hand but it's generated, DO NOT EDIT it, "+
+					"the changes are overwritten\n", file)
+			}
+		}
+	}
+	return nil
+}
+
+// Reconcile records the files generated by the successful results in the manifests of their output directories,
+// the skipped results keep their records. The files no longer generated by any thrift file are stale, they're
+// removed unless they're changed since they're generated, then they're kept with a warning. Nothing is written
+// or removed in dryRun, the stale files to be removed are returned either way.
+func Reconcile(w io.Writer, results []Result, dryRun bool) ([]string, error) {
+	byDir := make(map[string][]Result)
+	for _, r := range results {
+		if r.Err == nil && !r.Skipped {
+			dir := filepath.Clean(r.Target.Output)
+			byDir[dir] = append(byDir[dir], r)
+		}
+	}
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	// a file like the main shared by the output directories may be generated into another one
+	produced := make(map[string]bool)
+	for _, r := range results {
+		for _, f := range r.Files {
+			if abs, err := filepath.Abs(f.Name); err == nil {
+				produced[abs] = true
+			}
+		}
+	}
+
+	removed := make([]string, 0)
+	for _, dir := range dirs {
+		files, err := reconcileDir(w, dir, byDir[dir], produced, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, files...)
+	}
+	return removed, nil
+}
+
+func reconcileDir(w io.Writer, dir string, results []Result, produced map[string]bool, dryRun bool) ([]string, error) {
+	m, err := LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sources are refreshed for the generated thrift files and dropped for the removed ones
+	generated := make([]string, 0, len(results))
+	for _, r := range results {
+		idl, err := relPath(dir, r.Target.IDL)
+		if err != nil {
+			return nil, err
+		}
+		generated = append(generated, idl)
+		if r.Key != "" {
+			m.Inputs[idl] = r.Key
+		} else {
+			delete(m.Inputs, idl)
+		}
+	}
+	for idl := range m.Inputs {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(idl))); errors.Is(err, os.ErrNotExist) {
+			delete(m.Inputs, idl)
+		}
+	}
+	for _, entry := range m.Files {
+		sources := entry.Sources[:0]
+		for _, src := range entry.Sources {
+			if contains(generated, src) {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(src))); errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			sources = append(sources, src)
+		}
+		entry.Sources = sources
+	}
+
+	for i, r := range results {
+		for _, f := range r.Files {
+			name, err := relPath(dir, f.Name)
+			if err != nil {
+				return nil, err
+			}
+			entry := m.Files[name]
+			if entry == nil {
+				entry = &ManifestEntry{}
+				m.Files[name] = entry
+			}
+			// the written file is hashed since the main of several thrift files is merged
+			hash := hashContent(f.Content)
+			if !dryRun {
+				if hash, err = hashFile(f.Name); err != nil {
+					return nil, err
+				}
+			}
+			entry.SHA256, entry.DoNotEdit = hash, isDoNotEdit(f.Content)
+			if !contains(entry.Sources, generated[i]) {
+				entry.Sources = append(entry.Sources, generated[i])
+				sort.Strings(entry.Sources)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(m.Files))
+	for name, entry := range m.Files {
+		if len(entry.Sources) == 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	removed := make([]string, 0, len(names))
+	for _, name := range names {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		hash, err := hashFile(file)
+		if err != nil {
+			return nil, err
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case hash == "" || produced[abs]:
+			delete(m.Files, name)
+		case hash != m.Files[name].SHA256:
+			fmt.Fprintf(w, "[WARN] %s is no longer generated, it's kept since it's changed by hand, "+
+				"remove it if it's unused\n", file)
+		default:
+			removed = append(removed, file)
+			delete(m.Files, name)
+			if dryRun {
+				continue
+			}
+			if err := os.Remove(file); err != nil {
+				return nil, err
+			}
+			removeEmptyDirs(filepath.Dir(file), dir)
+			fmt.Fprintf(w, "removed the stale %s\n", file)
+		}
+	}
+
+	if dryRun {
+		return removed, nil
+	}
+	return removed, m.Save(dir)
+}
+
+// removeEmptyDirs removes the directory and its parents if they're empty, until the output directory.
+func removeEmptyDirs(dir, output string) {
+	for {
+		rel, err := relPath(output, dir)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			return
+		}
+		if entries, err := ioutil.ReadDir(dir); err != nil || len(entries) > 0 {
+			return
+		}
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
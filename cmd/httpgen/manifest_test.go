@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReconcilePrunesStale(t *testing.T) {
+	dir := newTestModule(t, "included")
+	target := testTarget(t, dir, "item.thrift")
+	target.Recursive = true
+	generate := func(target Target) string {
+		t.Helper()
+		targets, err := Plan([]Target{target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := GenerateAll(targets, 1, false, false)
+		for _, r := range results {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+		}
+		var out strings.Builder
+		if _, err := Reconcile(&out, results, false); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	generate(target)
+	m, err := LoadManifest(target.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := m.Files["item/router.gen.go"]; entry == nil || len(entry.Sources) != 1 || entry.Sources[0] != "../item.thrift" {
+		t.Fatalf("the router isn't recorded: %+v", entry)
+	}
+
+	// the file no longer generated is removed
+	withoutRouter := target
+	withoutRouter.Router = ""
+	router := filepath.Join(target.Output, "item", "router.gen.go")
+	if out := generate(withoutRouter); !strings.Contains(out, "removed the stale "+router) {
+		t.Errorf("expect the router removed, got:\n%s", out)
+	}
+	if _, err := os.Stat(router); !os.IsNotExist(err) {
+		t.Errorf("the stale router is kept: %v", err)
+	}
+
+	// the stale file changed by hand is kept
+	generate(target)
+	if err := writeFile(router, "package item\n"); err != nil {
+		t.Fatal(err)
+	}
+	if out := generate(withoutRouter); !strings.Contains(out, "[WARN] "+router+" is no longer generated") {
+		t.Errorf("expect the changed router kept, got:\n%s", out)
+	}
+	if _, err := os.Stat(router); err != nil {
+		t.Errorf("the changed router is removed: %v", err)
+	}
+}
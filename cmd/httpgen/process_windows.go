@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os/exec"
+)
+
+// shellCommand runs the command by cmd, windows has no process group to stop the processes it starts.
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+func interruptCommand(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func killCommand(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	generator "github.com/sunyakun/thriftgo-tools"
+)
+
+// RenderMode renders the templates in the directory with the IR exported by -ir, like the docs or the clients
+// of another language. The file of a template is written to the output directory without the .tmpl suffix.
+// The builtin templates like handler.tmpl and the ones the manifest generates per service are skipped, they're
+// executed by the generation.
+func RenderMode(args []string) {
+	var (
+		ir          string
+		templateDir string
+		output      string
+	)
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	flags.StringVar(&ir, "ir", "", "json file of the intermediate representation exported by -ir")
+	flags.StringVar(&templateDir, "template_dir", "", "directory of the templates, like docs/api.md.tmpl")
+	flags.StringVar(&output, "output", ".", "output directory")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: httpgen render -ir <ir.json> -template_dir <dir> [-output <dir>]\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if ir == "" || templateDir == "" || flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data, err := ioutil.ReadFile(ir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	desc, err := generator.LoadIR(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", ir, err)
+		os.Exit(1)
+	}
+	generateds, err := generator.NewGenerator().Render(desc, templateDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	files := make([]File, 0, len(generateds))
+	for _, g := range generateds {
+		f := File{Name: filepath.Join(output, g.GetName()), Content: []byte(g.GetContent())}
+		if strings.HasSuffix(f.Name, ".go") {
+			if formatted, err := format.Source(f.Content); err != nil {
+				fmt.Fprintf(os.Stderr, "[WARN] %s is not formatted: %v\n", f.Name, err)
+			} else {
+				f.Content = formatted
+			}
+		}
+		files = append(files, f)
+	}
+	if err := WriteFiles(files); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "rendered %d files into %s\n", len(files), output)
+}
@@ -0,0 +1,7 @@
+namespace go ext
+
+include "inc/base.thrift"
+
+service ExtService extends base.BaseService {
+    base.PingResp hello(1: base.PingReq req) (api.get="/hello"),
+}
@@ -0,0 +1,56 @@
+package gentest
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gentest/gen/base"
+	"gentest/gen/ext"
+	"gentest/gen/page"
+)
+
+type extService struct{}
+
+func (extService) Ping(ctx context.Context, req *base.PingReq) (*base.PingResp, error) {
+	return &base.PingResp{Msg: "pong " + req.GetMsg()}, nil
+}
+
+func (extService) List(ctx context.Context, req *page.Pagination) (*base.ListResp, error) {
+	return &base.ListResp{Items: []string{strings.Repeat("a", int(req.GetLimit()))}}, nil
+}
+
+func (extService) Hello(ctx context.Context, req *base.PingReq) (*base.PingResp, error) {
+	return &base.PingResp{Msg: "hello"}, nil
+}
+
+func TestExtends(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if _, err := ext.Register(router, extService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		url  string
+		code int
+		body string
+	}{
+		{"/ping?msg=x", 200, `{"msg":"pong x"}`},
+		{"/list?limit=2", 200, `{"items":["aa"]}`},
+		{"/list?limit=1000", 400, ""},
+		// the overridden function is routed by the child service only
+		{"/hello", 200, `{"msg":"hello"}`},
+		{"/base/hello", 404, ""},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", c.url, nil))
+		if w.Code != c.code || (c.body != "" && w.Body.String() != c.body) {
+			t.Errorf("%s: got %d %s", c.url, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,21 @@
+namespace go base
+
+include "page.thrift"
+
+struct PingReq {
+    1: optional string msg (api.query="msg"),
+}
+
+struct PingResp {
+    1: required string msg,
+}
+
+struct ListResp {
+    1: required list<string> items,
+}
+
+service BaseService {
+    PingResp ping(1: PingReq req) (api.get="/ping"),
+    ListResp list(1: page.Pagination req) (api.get="/list"),
+    PingResp hello(1: PingReq req) (api.get="/base/hello"),
+}
@@ -0,0 +1,5 @@
+namespace go page
+
+struct Pagination {
+    1: optional i32 limit (api.query="limit", api.vd="$==nil||$<=100"),
+}
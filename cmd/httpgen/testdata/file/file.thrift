@@ -0,0 +1,21 @@
+namespace go file
+
+struct UploadReq {
+    1: required binary avatar (api.file="avatar", api.file_max="1KB"),
+    2: optional list<binary> docs (api.file="docs"),
+    3: required string name (api.form="name"),
+}
+
+struct Download {
+    1: required binary data (api.raw_body="true"),
+    2: required string ctype (api.header="Content-Type"),
+}
+
+struct ReportReq {
+    1: required i64 id (api.path="id"),
+}
+
+service FileService {
+    Download upload(1: UploadReq req) (api.post="/upload"),
+    binary report(1: ReportReq req) (api.get="/reports/:id", api.content_type="application/pdf", api.filename="report.pdf"),
+}
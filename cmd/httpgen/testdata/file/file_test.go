@@ -0,0 +1,81 @@
+package gentest
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gentest/gen/file"
+)
+
+type fileService struct{}
+
+func (fileService) Upload(ctx context.Context, req *file.UploadReq) (*file.Download, error) {
+	data := req.Name + ":" + string(req.Avatar) + ":" + string(bytes.Join(req.Docs, []byte(",")))
+	return &file.Download{Data: []byte(data), Ctype: "text/plain"}, nil
+}
+
+func (fileService) Report(ctx context.Context, req *file.ReportReq) ([]byte, error) {
+	return []byte("%PDF"), nil
+}
+
+func fileRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if _, err := file.Register(router, fileService{}); err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+// upload sends the multipart request uploading the avatar of the size and two docs.
+func upload(t *testing.T, size int) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("name", "bob")
+	for _, f := range []struct{ field, name, data string }{
+		{"avatar", "a.png", strings.Repeat("a", size)},
+		{"docs", "1.txt", "d1"},
+		{"docs", "2.txt", "d2"},
+	} {
+		fw, err := w.CreateFormFile(f.field, f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(f.data))
+	}
+	w.Close()
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rw := httptest.NewRecorder()
+	fileRouter(t).ServeHTTP(rw, req)
+	return rw
+}
+
+func TestUpload(t *testing.T) {
+	w := upload(t, 3)
+	// the raw body is written as is with the content type of the header field
+	if w.Code != 200 || w.Body.String() != "bob:aaa:d1,d2" || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("got %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+	// the avatar exceeds the limit of 1KB
+	if w := upload(t, 2000); w.Code != 413 || !strings.Contains(w.Body.String(), `"rule":"file_max"`) {
+		t.Errorf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDownload(t *testing.T) {
+	w := httptest.NewRecorder()
+	fileRouter(t).ServeHTTP(w, httptest.NewRequest("GET", "/reports/1", nil))
+	if w.Code != 200 || w.Body.String() != "%PDF" || w.Header().Get("Content-Type") != "application/pdf" ||
+		w.Header().Get("Content-Disposition") != "attachment; filename=report.pdf" {
+		t.Errorf("got %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+}
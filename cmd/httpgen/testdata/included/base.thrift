@@ -0,0 +1,11 @@
+namespace go base
+
+struct Page {
+    1: required i64 id (api.path="id"),
+    2: optional i32 limit (api.query="limit"),
+}
+
+struct Item {
+    1: required i64 id,
+    2: optional i32 limit,
+}
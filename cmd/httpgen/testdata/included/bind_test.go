@@ -0,0 +1,32 @@
+package gentest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gentest/gen/base"
+	"gentest/gen/item"
+)
+
+type itemService struct{}
+
+func (itemService) Get(ctx context.Context, page *base.Page) (*base.Item, error) {
+	return &base.Item{ID: page.ID, Limit: page.Limit}, nil
+}
+
+func TestBindIncludedStruct(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if _, err := item.Register(router, itemService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/items/7?limit=20", nil))
+	if w.Code != 200 || w.Body.String() != `{"id":7,"limit":20}` {
+		t.Errorf("got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,7 @@
+namespace go item
+
+include "base.thrift"
+
+service ItemService {
+    base.Item get(1: base.Page page) (api.get="/items/:id"),
+}
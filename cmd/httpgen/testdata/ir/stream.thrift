@@ -0,0 +1,19 @@
+namespace go stream
+
+typedef string Tag
+
+struct GetReq {
+    1: required i64 id (api.path="id", api.vd="$>0"),
+}
+
+struct Download {
+    1: required binary data (api.raw_body=""),
+    2: optional string etag (api.header="ETag"),
+    3: optional list<Tag> tags,
+    4: optional GetReq source,
+}
+
+service StreamService {
+    Download get(1: GetReq req) (api.get="/streams/:id", api.timeout="1500ms", api.content_type="text/plain"),
+    oneway void touch(1: GetReq req) (api.post="/streams/:id/touch"),
+}
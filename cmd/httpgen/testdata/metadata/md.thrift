@@ -0,0 +1,14 @@
+namespace go md
+
+struct Metadata {
+    1: required i64 id (api.path="id"),
+}
+
+struct ClientIP {
+    1: required i64 id,
+    2: required string ip,
+}
+
+service MetadataService {
+    ClientIP get(1: Metadata req) (api.get="/md/:id"),
+}
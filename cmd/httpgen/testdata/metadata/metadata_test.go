@@ -0,0 +1,32 @@
+package gentest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gentest/gen/md"
+)
+
+type metadataService struct{}
+
+// the metadata generated into the package doesn't collide with the structs named like it
+func (metadataService) Get(ctx context.Context, req *md.Metadata) (*md.ClientIP, error) {
+	return &md.ClientIP{ID: req.ID, IP: md.HTTPMetaClientIP(ctx)}, nil
+}
+
+func TestMetadataInPackage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if _, err := md.Register(router, metadataService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/md/7", nil))
+	if w.Code != 200 || w.Body.String() != `{"id":7,"ip":"192.0.2.1"}` {
+		t.Errorf("got %d %s", w.Code, w.Body.String())
+	}
+}
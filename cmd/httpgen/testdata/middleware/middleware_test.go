@@ -0,0 +1,80 @@
+package gentest
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"gentest/gen/mw"
+)
+
+type middlewareService struct{}
+
+func (middlewareService) Get(ctx context.Context, req *mw.Req) (*mw.Resp, error) {
+	return &mw.Resp{Name: "ok"}, nil
+}
+
+func TestUnregisteredMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, err := mw.Register(gin.New(), middlewareService{})
+	if err == nil || !strings.Contains(err.Error(), "auth") {
+		t.Errorf("expect the error of the unregistered middleware, got %v", err)
+	}
+}
+
+func TestAbortedByMiddleware(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if err := mw.RegisterMetrics(registry); err != nil {
+		t.Fatal(err)
+	}
+	var logs strings.Builder
+	auth := func(ctx *gin.Context) {
+		if ctx.GetHeader("Authorization") == "" {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	_, err := mw.Register(router, middlewareService{},
+		mw.WithMiddlewares(map[string]gin.HandlerFunc{"auth": auth}),
+		mw.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/mw/1", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), "msg=handled") || !strings.Contains(logs.String(), "status=401") {
+		t.Errorf("expect the aborted request logged, got:\n%s", logs.String())
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counted := 0.0
+	for _, family := range families {
+		if family.GetName() != "httpgen_requests_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "status" && label.GetValue() == "401" {
+					counted += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	if counted != 1 {
+		t.Errorf("expect the aborted request counted once, got %v", counted)
+	}
+}
@@ -0,0 +1,13 @@
+namespace go mw
+
+struct Req {
+    1: required i64 id (api.path="id"),
+}
+
+struct Resp {
+    1: required string name,
+}
+
+service MiddlewareService {
+    Resp get(1: Req req) (api.get="/mw/:id", api.middleware="auth"),
+}
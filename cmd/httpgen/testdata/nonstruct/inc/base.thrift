@@ -0,0 +1,5 @@
+namespace go base
+
+struct PingResp {
+    1: required string msg,
+}
@@ -0,0 +1,73 @@
+package gentest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gentest/gen/base"
+	"gentest/gen/ns"
+)
+
+type nsService struct{}
+
+func (nsService) Items(ctx context.Context, req *ns.Req) ([]*ns.Item, error) {
+	return []*ns.Item{{ID: 1}}, nil
+}
+
+func (nsService) Counts(ctx context.Context, req *ns.Req) (map[string]int64, error) {
+	return map[string]int64{"a": 1}, nil
+}
+
+func (nsService) Name(ctx context.Context, req *ns.Req) (string, error) {
+	return req.GetQ(), nil
+}
+
+func (nsService) Pong(ctx context.Context, req *ns.Req) (*ns.Pong, error) {
+	return &base.PingResp{Msg: "p"}, nil
+}
+
+func (nsService) Pongs(ctx context.Context, req *ns.Req) ([]*base.PingResp, error) {
+	return []*base.PingResp{{Msg: "p"}}, nil
+}
+
+func (nsService) Blob(ctx context.Context, req *ns.Req) (ns.Blob, error) {
+	return []byte("xx"), nil
+}
+
+func (nsService) Head(ctx context.Context, req *ns.Req) (*ns.Head, error) {
+	return &ns.HeadResp{Etag: "e", Msg: "m"}, nil
+}
+
+func TestNonStructResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if _, err := ns.Register(router, nsService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct{ url, body string }{
+		{"/items", `[{"id":1}]`},
+		{"/counts", `{"a":1}`},
+		{"/name?q=n", `"n"`},
+		{"/pong", `{"msg":"p"}`},
+		{"/pongs", `[{"msg":"p"}]`},
+		// the binary typedef is written as a raw stream
+		{"/blob", "xx"},
+		{"/head", `{"msg":"m"}`},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", c.url, nil))
+		if w.Code != 200 || w.Body.String() != c.body {
+			t.Errorf("%s: got %d %s", c.url, w.Code, w.Body.String())
+		}
+	}
+	// the header field of the typedef is written to the header as well
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/head", nil))
+	if etag := w.Header().Get("ETag"); etag != "e" {
+		t.Errorf("unexpected etag %q", etag)
+	}
+}
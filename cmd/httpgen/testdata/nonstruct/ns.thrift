@@ -0,0 +1,31 @@
+namespace go ns
+
+include "inc/base.thrift"
+
+typedef base.PingResp Pong
+typedef binary Blob
+
+struct Item {
+    1: required i64 id,
+}
+
+struct Req {
+    1: optional string q (api.query="q"),
+}
+
+struct HeadResp {
+    1: required string etag (api.header="ETag"),
+    2: required string msg,
+}
+
+typedef HeadResp Head
+
+service NSService {
+    list<Item> items(1: Req req) (api.get="/items"),
+    map<string, i64> counts(1: Req req) (api.get="/counts"),
+    string name(1: Req req) (api.get="/name"),
+    Pong pong(1: Req req) (api.get="/pong"),
+    list<base.PingResp> pongs(1: Req req) (api.get="/pongs"),
+    Blob blob(1: Req req) (api.get="/blob"),
+    Head head(1: Req req) (api.get="/head"),
+}
@@ -0,0 +1,54 @@
+package gentest
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gentest/gen/ow"
+)
+
+type onewayService struct {
+	pinged int64
+}
+
+func (s *onewayService) Ping(ctx context.Context, req *ow.PingReq) error {
+	time.Sleep(50 * time.Millisecond)
+	atomic.AddInt64(&s.pinged, req.ID)
+	return nil
+}
+
+func TestShutdownDrainsDefaultPool(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	service := &onewayService{}
+	handler, err := ow.Register(router, service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/ping/2", nil))
+		if w.Code >= 300 {
+			t.Fatalf("got %d %s", w.Code, w.Body.String())
+		}
+	}
+	if err := handler.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if pinged := atomic.LoadInt64(&service.pinged); pinged != 6 {
+		t.Errorf("expect the accepted calls finished on shutdown, got %d", pinged)
+	}
+
+	// the calls after the shutdown are rejected rather than leaking into a stopped pool
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/ping/2", nil))
+	if w.Code < 500 {
+		t.Errorf("expect the call after shutdown rejected, got %d", w.Code)
+	}
+}
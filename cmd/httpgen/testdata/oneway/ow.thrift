@@ -0,0 +1,9 @@
+namespace go ow
+
+struct PingReq {
+    1: required i64 id (api.path="id"),
+}
+
+service OnewayService {
+    oneway void ping(1: PingReq req) (api.post="/ping/:id"),
+}
@@ -0,0 +1,13 @@
+namespace go ot
+
+struct Req {
+    1: required i64 id (api.path="id"),
+}
+
+struct Resp {
+    1: required string name,
+}
+
+service OTelService {
+    Resp get(1: Req req) (api.get="/ot/:id"),
+}
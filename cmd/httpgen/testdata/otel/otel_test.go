@@ -0,0 +1,92 @@
+package gentest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"gentest/gen/ot"
+)
+
+type otelService struct{}
+
+func (otelService) Get(ctx context.Context, req *ot.Req) (*ot.Resp, error) {
+	if req.ID == 13 {
+		return nil, errors.New("unlucky")
+	}
+	return &ot.Resp{Name: "ok"}, nil
+}
+
+func TestServiceErrorStatus(t *testing.T) {
+	spans := tracetest.NewInMemoryExporter()
+	reader := sdkmetric.NewManualReader()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	_, err := ot.Register(router, otelService{},
+		ot.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))),
+		ot.WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/ot/1", "/ot/13"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	statusOf := func(attrs attribute.Set) int64 {
+		v, _ := attrs.Value("http.response.status_code")
+		return v.AsInt64()
+	}
+	ended := spans.GetSpans()
+	if len(ended) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(ended))
+	}
+	if s := ended[0]; statusOf(attribute.NewSet(s.Attributes...)) != http.StatusOK || s.Status.Code == codes.Error {
+		t.Errorf("span of the success: %v %v", s.Attributes, s.Status)
+	}
+	if s := ended[1]; statusOf(attribute.NewSet(s.Attributes...)) != http.StatusInternalServerError ||
+		s.Status.Code != codes.Error || s.Status.Description != "unlucky" {
+		t.Errorf("span of the service error: %v %v", s.Attributes, s.Status)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	recorded := make(map[string]map[int64]bool)
+	record := func(name string, attrs attribute.Set) {
+		if recorded[name] == nil {
+			recorded[name] = make(map[int64]bool)
+		}
+		recorded[name][statusOf(attrs)] = true
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					record(m.Name, dp.Attributes)
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					record(m.Name, dp.Attributes)
+				}
+			}
+		}
+	}
+	for _, name := range []string{"http.server.request.count", "http.server.request.duration"} {
+		if statuses := recorded[name]; len(statuses) != 2 || !statuses[http.StatusOK] || !statuses[http.StatusInternalServerError] {
+			t.Errorf("statuses of %s: %v", name, statuses)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package gentest
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"gentest/gen/pm"
+)
+
+type prometheusService struct{}
+
+func (prometheusService) Get(ctx context.Context, req *pm.Req) (*pm.Resp, error) {
+	if req.ID == 13 {
+		return nil, errors.New("unlucky")
+	}
+	return &pm.Resp{Name: "ok"}, nil
+}
+
+func TestServiceErrorStatus(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if err := pm.RegisterMetrics(registry); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if _, err := pm.Register(router, prometheusService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/pm/1", "/pm/13", "/pm/x"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests, failures := make(map[string]float64), make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			switch family.GetName() {
+			case "httpgen_requests_total":
+				for _, label := range m.GetLabel() {
+					if label.GetName() == "status" {
+						requests[label.GetValue()] += m.GetCounter().GetValue()
+					}
+				}
+			case "httpgen_bind_errors_total", "httpgen_service_errors_total":
+				failures[family.GetName()] += m.GetCounter().GetValue()
+			}
+		}
+	}
+	if len(requests) != 3 || requests["200"] != 1 || requests["400"] != 1 || requests["500"] != 1 {
+		t.Errorf("requests by status: %v", requests)
+	}
+	if failures["httpgen_bind_errors_total"] != 1 || failures["httpgen_service_errors_total"] != 1 {
+		t.Errorf("failures: %v", failures)
+	}
+}
@@ -0,0 +1,14 @@
+namespace go rd
+
+struct Secret {
+    1: required string name,
+    2: optional string token (api.sensitive="true"),
+}
+
+struct Req {
+    1: required i64 id (api.path="id"),
+}
+
+service RedactService {
+    list<Secret> list(1: Req req) (api.get="/secrets/:id"),
+}
@@ -0,0 +1,40 @@
+package gentest
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gentest/gen/rd"
+)
+
+type redactService struct{}
+
+func (redactService) List(ctx context.Context, req *rd.Req) ([]*rd.Secret, error) {
+	token := "t0k3n"
+	return []*rd.Secret{{Name: "db", Token: &token}}, nil
+}
+
+func TestRedactedResponseLog(t *testing.T) {
+	var logs strings.Builder
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	_, err := rd.Register(router, redactService{}, rd.WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/secrets/1", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"token":"t0k3n"`) {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	// the elements of the response are redacted in the log only
+	if strings.Contains(logs.String(), "t0k3n") || !strings.Contains(logs.String(), "[REDACTED]") {
+		t.Errorf("expect the token redacted, got:\n%s", logs.String())
+	}
+}
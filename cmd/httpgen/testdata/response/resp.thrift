@@ -0,0 +1,16 @@
+namespace go resp
+
+struct CreateReq {
+    1: required string name,
+}
+
+struct CreateResp {
+    1: required i64 id,
+    2: required string location (api.header="Location"),
+    3: optional string session (api.cookie="session"),
+    4: required i32 code (api.http_code="true"),
+}
+
+service RespService {
+    CreateResp create(1: CreateReq req) (api.post="/resp"),
+}
@@ -0,0 +1,42 @@
+package gentest
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gentest/gen/resp"
+)
+
+type respService struct{}
+
+func (respService) Create(ctx context.Context, req *resp.CreateReq) (*resp.CreateResp, error) {
+	session := "s3ss10n"
+	return &resp.CreateResp{ID: 3, Location: "/resp/3", Session: &session, Code: 201}, nil
+}
+
+func TestResponseHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if _, err := resp.Register(router, respService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/resp", strings.NewReader(`{"name":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	// the annotated fields are written to the header, the cookie and the status instead of the body
+	if w.Code != 201 || w.Body.String() != `{"id":3}` {
+		t.Errorf("got %d %s", w.Code, w.Body.String())
+	}
+	if location := w.Header().Get("Location"); location != "/resp/3" {
+		t.Errorf("unexpected location %q", location)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != "session" || cookies[0].Value != "s3ss10n" {
+		t.Errorf("unexpected cookies %v", cookies)
+	}
+}
@@ -0,0 +1,6 @@
+namespace go audit
+
+struct Event {
+    1: required i64 id (api.query="id"),
+    2: optional string token (api.sensitive="true"),
+}
@@ -0,0 +1,21 @@
+namespace go note
+
+include "audit.thrift"
+
+struct GetReq {
+    1: required i64 id (api.path="id"),
+}
+
+struct Note {
+    1: required i64 id,
+    2: optional string text,
+}
+
+// the event isn't used by the handler, so the annotations of audit.thrift can be skipped
+struct Archive {
+    1: optional list<audit.Event> events,
+}
+
+service NoteService {
+    Note get(1: GetReq req) (api.get="/notes/:id"),
+}
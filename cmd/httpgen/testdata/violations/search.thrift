@@ -0,0 +1,20 @@
+namespace go search
+
+struct Filter {
+    1: optional i32 limit (api.query="limit", api.vd="$<=100"),
+}
+
+struct SearchReq {
+    1: required i64 id (api.path="id", api.vd="$>0"),
+    2: optional i32 page (api.query="page"),
+    3: optional string name (api.vd="len($)>=3"),
+    4: optional Filter filter,
+}
+
+struct SearchResp {
+    1: required i64 id,
+}
+
+service SearchService {
+    SearchResp search(1: SearchReq req) (api.post="/search/:id"),
+}
@@ -0,0 +1,73 @@
+package gentest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gentest/gen/search"
+)
+
+type searchService struct{}
+
+func (searchService) Search(ctx context.Context, req *search.SearchReq) (*search.SearchResp, error) {
+	return &search.SearchResp{ID: req.ID}, nil
+}
+
+func TestViolations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if _, err := search.Register(router, searchService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		url  string
+		body string
+		want []string // the violations as in:field:rule
+	}{
+		{
+			name: "every stage",
+			url:  "/search/0?page=x",
+			body: `{"name":"ab","filter":{"limit":500}}`,
+			want: []string{"query:page:type", "path:id:$>0", "body:name:len($)>=3", "body:filter.limit:$<=100"},
+		},
+		{
+			name: "nested field from the query",
+			url:  "/search/1?limit=500",
+			body: `{"name":"abc"}`,
+			want: []string{"query:limit:$<=100"},
+		},
+		{
+			name: "body failed decoding",
+			url:  "/search/0",
+			body: `{"name":5}`,
+			want: []string{"body:name:type", "path:id:$>0"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", c.url, strings.NewReader(c.body))
+			r.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, r)
+			var resp search.BadRequestResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != 400 {
+				t.Fatalf("got %d %s", w.Code, w.Body.String())
+			}
+			got := make([]string, 0, len(resp.Violations))
+			for _, v := range resp.Violations {
+				got = append(got, v.In+":"+v.Field+":"+v.Rule)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expect violations %v, got %v", c.want, got)
+			}
+		})
+	}
+}
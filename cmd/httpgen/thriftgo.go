@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+
+	thriftgo "github.com/cloudwego/thriftgo/generator"
+	"github.com/cloudwego/thriftgo/generator/backend"
+	"github.com/cloudwego/thriftgo/generator/golang"
+	"github.com/cloudwego/thriftgo/parser"
+	"github.com/cloudwego/thriftgo/plugin"
+	"github.com/cloudwego/thriftgo/semantic"
+
+	generator "github.com/sunyakun/thriftgo-tools"
+)
+
+// pluginName is the name of the http plugin run in process by thriftgo.
+const pluginName = "httpgen"
+
+// httpPlugin runs the generator in process as a thriftgo plugin.
+type httpPlugin struct{}
+
+func (httpPlugin) Name() string {
+	return pluginName
+}
+
+func (httpPlugin) Execute(req *plugin.Request) (res *plugin.Response) {
+	// a panic of the generator fails the generation of the thrift file rather than the process
+	defer func() {
+		if r := recover(); r != nil {
+			res = plugin.BuildErrorResponse(fmt.Sprint(r))
+		}
+	}()
+	args := ParsePluginArgs(req.PluginParameters, req.GeneratorParameters)
+	resp, err := generator.NewGenerator().Execute(req, args)
+	if err != nil {
+		return plugin.BuildErrorResponse(err.Error())
+	}
+	return resp
+}
+
+// goBackend is the go backend of thriftgo serving the http plugin, the other plugins are looked up as usual.
+type goBackend struct {
+	*golang.GoBackend
+}
+
+func (b goBackend) GetPlugin(desc *plugin.Desc) plugin.Plugin {
+	if desc.Name == pluginName {
+		return httpPlugin{}
+	}
+	return b.GoBackend.GetPlugin(desc)
+}
+
+// thriftgoVersion returns the version of the thriftgo library, it's passed to the plugin like thriftgo does.
+func thriftgoVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/cloudwego/thriftgo" {
+				return dep.Version
+			}
+		}
+	}
+	return "unknown"
+}
+
+// File is a file generated by thriftgo and the http plugin.
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// WriteFiles writes the generated files, the directories of them are created if missing.
+func WriteFiles(files []File) error {
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.Name), 0755); err != nil {
+			return fmt.Errorf("failed to create path '%s': %w", filepath.Dir(f.Name), err)
+		}
+		if err := ioutil.WriteFile(f.Name, f.Content, 0644); err != nil {
+			return fmt.Errorf("failed to write file '%s': %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// runThriftgo generates the thrift file like the thriftgo command with the go generator and the http plugin,
+// which are given as the compact arguments like "go:package_prefix=example.com/gen". The files are returned
+// rather than written and the warnings go to stderr.
+func runThriftgo(idl, output string, recursive bool, lang, httpPlugin string, stderr io.Writer) ([]File, error) {
+	logger := log.New(stderr, "[WARN] ", 0)
+	logs := backend.DummyLogFunc()
+	logs.Warn = func(v ...interface{}) { logger.Println(v...) }
+	logs.MultiWarn = func(warns []string) {
+		for _, w := range warns {
+			logger.Println(w)
+		}
+	}
+
+	ast, err := parser.ParseFile(idl, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	if path := parser.CircleDetect(ast); len(path) > 0 {
+		return nil, fmt.Errorf("found include circle:\n\t%s", path)
+	}
+	checker := semantic.NewChecker(semantic.Options{FixWarnings: true})
+	warns, err := checker.CheckAll(ast)
+	logs.MultiWarn(warns)
+	if err != nil {
+		return nil, err
+	}
+	if err := semantic.ResolveSymbols(ast); err != nil {
+		return nil, err
+	}
+
+	out, err := plugin.ParseCompactArguments(lang)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := plugin.ParseCompactArguments(httpPlugin)
+	if err != nil {
+		return nil, err
+	}
+
+	var g thriftgo.Generator
+	be := goBackend{new(golang.GoBackend)}
+	if err := g.RegisterBackend(be); err != nil {
+		return nil, err
+	}
+	req := &plugin.Request{
+		Version:    thriftgoVersion(),
+		OutputPath: output,
+		Recursive:  recursive,
+		AST:        ast,
+		Language:   out.Name,
+	}
+	res := g.Generate(&thriftgo.Arguments{
+		Out: &thriftgo.LangSpec{Language: out.Name, Options: out.Options, UsedPlugins: []*plugin.Desc{desc}},
+		Req: req,
+		Log: logs,
+	})
+	if err := res.GetError(); err != "" {
+		return nil, errors.New(err)
+	}
+
+	// the go files are formatted like thriftgo does when it persists them
+	files := make([]File, 0, len(res.Contents))
+	for i, c := range res.Contents {
+		if c.GetName() == "" {
+			return nil, fmt.Errorf("file name not found for the %dth generated item", i)
+		}
+		content, err := be.PostProcess(c.GetName(), []byte(c.Content))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: c.GetName(), Content: content})
+	}
+	return files, nil
+}
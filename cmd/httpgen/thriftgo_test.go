@@ -0,0 +1,98 @@
+package main
+
+import (
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateFiles(t *testing.T) {
+	cases := []struct {
+		name    string
+		files   map[string]string
+		wantErr string // the generation fails with the error instead
+	}{
+		{
+			name: "generated in process",
+			files: map[string]string{
+				"ping.thrift": "namespace go ping\nstruct Req {1: required i64 id (api.path=\"id\")}\n" +
+					"struct Resp {1: required i64 id}\nservice PingService {Resp ping(1: Req req) (api.get=\"/ping/:id\")}\n",
+			},
+		},
+		{
+			name:    "invalid syntax",
+			files:   map[string]string{"ping.thrift": "namespace go ping\nstruct Req {\n"},
+			wantErr: "ping.thrift",
+		},
+		{
+			name: "include circle",
+			files: map[string]string{
+				"ping.thrift": "namespace go ping\ninclude \"pong.thrift\"\n",
+				"pong.thrift": "namespace go pong\ninclude \"ping.thrift\"\n",
+			},
+			wantErr: "include circle",
+		},
+		{
+			name: "undefined type",
+			files: map[string]string{
+				"ping.thrift": "namespace go ping\nstruct Req {1: required Missing id}\n",
+			},
+			wantErr: "Missing",
+		},
+		{
+			name: "failed plugin",
+			files: map[string]string{
+				"ping.thrift": "namespace go ping\nstruct Req {}\n" +
+					"service PingService {Req ping(1: Req req)}\nservice PongService {Req pong(1: Req req)}\n",
+			},
+			wantErr: "only one service",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range c.files {
+				if err := writeFile(filepath.Join(dir, name), content); err != nil {
+					t.Fatal(err)
+				}
+			}
+			target := testTarget(t, dir, "ping.thrift")
+			files, err := GenerateFiles(target, ioutil.Discard)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("expect an error of '%s', got %v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the files are returned formatted rather than written
+			names := make(map[string]string)
+			for _, f := range files {
+				rel, err := filepath.Rel(target.Output, f.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				names[filepath.ToSlash(rel)] = string(f.Content)
+			}
+			for _, name := range []string{"ping/ping.go", "ping/handler.gen.go", "ping/router.gen.go"} {
+				content, ok := names[name]
+				if !ok {
+					t.Errorf("%s isn't generated", name)
+					continue
+				}
+				if formatted, err := format.Source([]byte(content)); err != nil || string(formatted) != content {
+					t.Errorf("%s isn't formatted: %v", name, err)
+				}
+			}
+			if _, err := os.Stat(target.Output); !os.IsNotExist(err) {
+				t.Errorf("the output is written: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cloudwego/thriftgo/parser"
+)
+
+const (
+	// watchInterval is the interval of polling the watched files.
+	watchInterval = 500 * time.Millisecond
+	// watchDebounce is how long the files stay unchanged before they're regenerated, so that the burst of
+	// writes by an editor or a git checkout is regenerated once.
+	watchDebounce = 300 * time.Millisecond
+	// stopTimeout is how long the command of -run has to exit before it's killed.
+	stopTimeout = 5 * time.Second
+)
+
+// stamp is the state of a watched file, it's zero if the file doesn't exist.
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+type watcher struct {
+	out     io.Writer
+	targets []Target // the targets before planning, they're planned again on every change
+	jobs    int
+	runner  *runner
+
+	planned  map[Target]bool
+	includes map[string][]string // the thrift file => itself and the files it includes transitively
+	stamps   map[string]stamp
+}
+
+// Watch generates the targets, then regenerates the affected ones whenever their thrift files, the included
+// ones or the templates change, until it's interrupted. The diagnostics are written to out rather than ending
+// the watch. If command isn't empty, it's run by the shell after every successful generation, and the previous
+// run is stopped first, like 'go run ./cmd/server'.
+func Watch(out io.Writer, targets []Target, jobs int, command string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := &watcher{
+		out:      out,
+		targets:  targets,
+		jobs:     jobs,
+		planned:  make(map[Target]bool),
+		includes: make(map[string][]string),
+	}
+	if command != "" {
+		w.runner = &runner{command: command, out: out}
+		defer w.runner.stop()
+	}
+
+	w.regenerate(nil)
+	stamps, templates := w.scan()
+	w.stamps = stamps
+	fmt.Fprintf(out, "watching %d thrift files and %d templates, press Ctrl+C to stop\n",
+		len(stamps)-len(templates), len(templates))
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed := w.poll()
+		if len(changed) == 0 {
+			continue
+		}
+		// wait until the files settle down
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchDebounce):
+			}
+			more := w.poll()
+			if len(more) == 0 {
+				break
+			}
+			changed = append(changed, more...)
+		}
+		w.regenerate(changed)
+	}
+}
+
+// poll returns the watched files changed since the last poll.
+func (w *watcher) poll() []string {
+	stamps, templates := w.scan()
+	changed := make([]string, 0)
+	for name, s := range stamps {
+		old, ok := w.stamps[name]
+		// a file included by a new include statement is watched from now on, the thrift file including it
+		// has changed anyway, but a new template is a change of the templates
+		if ok && old != s || !ok && templates[name] {
+			changed = append(changed, name)
+		}
+	}
+	for name := range w.stamps {
+		if _, ok := stamps[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	w.stamps = stamps
+	sort.Strings(changed)
+	return changed
+}
+
+// scan stats the watched files, the templates are listed again to find the new ones.
+func (w *watcher) scan() (stamps map[string]stamp, templates map[string]bool) {
+	stamps = make(map[string]stamp)
+	templates = make(map[string]bool)
+	add := func(name string) {
+		if fi, err := os.Stat(name); err == nil {
+			stamps[name] = stamp{fi.ModTime(), fi.Size()}
+		} else {
+			stamps[name] = stamp{}
+		}
+	}
+
+	for _, t := range w.targets {
+		add(filepath.Clean(t.IDL))
+	}
+	for _, files := range w.includes {
+		for _, f := range files {
+			add(f)
+		}
+	}
+	for _, dir := range w.templateDirs() {
+		_ = filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				add(name)
+				templates[name] = true
+			}
+			return nil
+		})
+	}
+	return stamps, templates
+}
+
+func (w *watcher) templateDirs() []string {
+	dirs := make([]string, 0, 1)
+	for _, t := range w.targets {
+		if dir := filepath.Clean(t.TemplateDir); t.TemplateDir != "" && !contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// regenerate plans the targets again and regenerates the ones affected by the changed files,
+// all of them are generated if changed is nil.
+func (w *watcher) regenerate(changed []string) {
+	if changed != nil {
+		fmt.Fprintf(w.out, "%s changed\n", strings.Join(changed, ", "))
+	}
+	start := time.Now()
+	targets, err := Plan(w.targets)
+	if err != nil {
+		fmt.Fprintf(w.out, "[ERROR] %v\n", err)
+		return
+	}
+
+	affected := make([]Target, 0, len(targets))
+	planned := make(map[Target]bool, len(targets))
+	for _, t := range targets {
+		planned[t] = true
+		idl := filepath.Clean(t.IDL)
+		old := w.includes[idl]
+		// the included files of the last successful parse are kept, so that fixing one of them is noticed
+		if files, err := includedFiles(idl); err == nil {
+			w.includes[idl] = files
+		}
+		if changed == nil || !w.planned[t] || affects(changed, old, w.includes[idl], t.TemplateDir) {
+			affected = append(affected, t)
+		}
+	}
+	w.planned = planned
+	if len(affected) == 0 {
+		return
+	}
+
+	if err := WarnEdited(w.out, affected); err != nil {
+		fmt.Fprintf(w.out, "[ERROR] %v\n", err)
+	}
+	results := GenerateAll(affected, w.jobs, false, false)
+	failed := Summarize(w.out, results, false, time.Since(start))
+	if _, err := Reconcile(w.out, results, false); err != nil {
+		fmt.Fprintf(w.out, "[ERROR] %v\n", err)
+		return
+	}
+	if failed == 0 && w.runner != nil {
+		w.runner.restart()
+	}
+}
+
+// affects reports whether a changed file is one of the files or in the template directory.
+func affects(changed, old, files []string, templateDir string) bool {
+	for _, name := range changed {
+		if contains(old, name) || contains(files, name) {
+			return true
+		}
+		if rel, err := filepath.Rel(filepath.Clean(templateDir), name); templateDir != "" && err == nil &&
+			!strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// includedFiles returns the thrift file and the files it includes transitively.
+func includedFiles(idl string) ([]string, error) {
+	ast, err := parser.ParseFile(idl, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for inc := range ast.DepthFirstSearch() {
+		files = append(files, filepath.Clean(inc.Filename))
+	}
+	return files, nil
+}
+
+// runner runs the command of -run, like rebuilding and starting the server.
+type runner struct {
+	command string
+	out     io.Writer
+	cmd     *exec.Cmd
+	done    chan struct{}
+	stopped *int32 // set once the command is stopped by the runner
+}
+
+func (r *runner) restart() {
+	r.stop()
+	fmt.Fprintf(r.out, "running %s\n", r.command)
+	cmd := shellCommand(r.command)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(r.out, "[ERROR] %s: %v\n", r.command, err)
+		return
+	}
+	r.cmd, r.done, r.stopped = cmd, make(chan struct{}), new(int32)
+	go func(done chan struct{}, stopped *int32) {
+		if err := cmd.Wait(); err != nil && atomic.LoadInt32(stopped) == 0 {
+			fmt.Fprintf(r.out, "%s exited: %v\n", r.command, err)
+		}
+		close(done)
+	}(r.done, r.stopped)
+}
+
+// stop interrupts the command and the processes started by it, they're killed if they don't exit in time.
+func (r *runner) stop() {
+	if r.cmd == nil {
+		return
+	}
+	select {
+	case <-r.done:
+	default:
+		atomic.StoreInt32(r.stopped, 1)
+		_ = interruptCommand(r.cmd)
+		select {
+		case <-r.done:
+		case <-time.After(stopTimeout):
+			_ = killCommand(r.cmd)
+			<-r.done
+		}
+	}
+	r.cmd = nil
+}
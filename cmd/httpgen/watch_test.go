@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWatchRegeneratesAffected(t *testing.T) {
+	dir := newTestModule(t, "included", "otel")
+	item := testTarget(t, dir, "item.thrift")
+	item.Recursive = true
+	var out strings.Builder
+	w := &watcher{
+		out:      &out,
+		targets:  []Target{item, testTarget(t, dir, "ot.thrift")},
+		jobs:     1,
+		planned:  make(map[Target]bool),
+		includes: make(map[string][]string),
+	}
+	w.regenerate(nil)
+	w.stamps, _ = w.scan()
+	// the included file is planned as a target of its own
+	if !strings.Contains(out.String(), "generated 3 of 3 thrift files") {
+		t.Fatalf("expect every thrift file generated, got:\n%s", out.String())
+	}
+
+	// the changed file and the ones including it are regenerated only
+	base := filepath.Join(dir, "base.thrift")
+	f, err := os.OpenFile(base, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString("\nstruct Extra {\n    1: required i64 id,\n}\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	// the planned files are relative to the working directory
+	changed := w.poll()
+	if len(changed) != 1 {
+		t.Fatalf("unexpected changed files %v", changed)
+	}
+	if abs, err := filepath.Abs(changed[0]); err != nil || abs != base {
+		t.Fatalf("unexpected changed file %s: %v", changed[0], err)
+	}
+	w.regenerate(changed)
+	if !strings.Contains(out.String(), "generated 2 of 2 thrift files") {
+		t.Errorf("expect the affected thrift files generated, got:\n%s", out.String())
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "gen", "base", "base.go")); err != nil ||
+		!strings.Contains(string(data), "type Extra struct") {
+		t.Errorf("the included file isn't regenerated: %v", err)
+	}
+
+	out.Reset()
+	if changed := w.poll(); len(changed) != 0 {
+		t.Errorf("unexpected changed files %v", changed)
+	}
+	w.regenerate([]string{filepath.Join(dir, "unwatched.thrift")})
+	if strings.Contains(out.String(), "generated") {
+		t.Errorf("expect nothing generated, got:\n%s", out.String())
+	}
+}
+
+func TestAffects(t *testing.T) {
+	files := []string{"/idl/item.thrift", "/idl/base.thrift"}
+	cases := []struct {
+		name        string
+		changed     []string
+		old         []string
+		templateDir string
+		want        bool
+	}{
+		{name: "included file", changed: []string{"/idl/base.thrift"}, want: true},
+		{name: "unrelated file", changed: []string{"/idl/other.thrift"}},
+		{name: "file no longer included", changed: []string{"/idl/old.thrift"}, old: []string{"/idl/old.thrift"}, want: true},
+		{name: "template", changed: []string{"/tpl/handler.tmpl"}, templateDir: "/tpl/", want: true},
+		{name: "sibling of the templates", changed: []string{"/tpl2/handler.tmpl"}, templateDir: "/tpl"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := affects(c.changed, c.old, files, c.templateDir); got != c.want {
+				t.Errorf("expect %v, got %v", c.want, got)
+			}
+		})
+	}
+}
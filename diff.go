@@ -0,0 +1,159 @@
+package thriftgo_tools
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of the unchanged lines around a change in a hunk.
+const diffContext = 3
+
+// maxDiffCells bounds the table of the line diff, the changed lines of larger files are replaced as a whole.
+const maxDiffCells = 1 << 24
+
+type diffLine struct {
+	kind byte // ' ' for the unchanged line, '-' for the removed one and '+' for the added one
+	text string
+}
+
+// UnifiedDiff returns the unified diff turning old into new, it's empty if they're equal.
+func UnifiedDiff(oldName, newName string, old, new []byte) string {
+	if bytes.Equal(old, new) {
+		return ""
+	}
+	lines := diffLines(splitLines(string(old)), splitLines(string(new)))
+
+	// the line numbers in the old and new files before every line of the diff
+	oldLine := make([]int, len(lines)+1)
+	newLine := make([]int, len(lines)+1)
+	for i, l := range lines {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if l.kind != '+' {
+			oldLine[i+1]++
+		}
+		if l.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// the changes separated by less than twice the context lines share a hunk
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		stop := end + diffContext
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldLine[start], oldLine[stop]-oldLine[start]),
+			hunkRange(newLine[start], newLine[stop]-newLine[start]))
+		for _, l := range lines[start:stop] {
+			b.WriteByte(l.kind)
+			b.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return b.String()
+}
+
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
+
+// splitLines splits s into the lines with their line breaks.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines diffs the lines by their longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(ma), len(mb)
+	i, j := 0, 0
+	if n*m <= maxDiffCells {
+		// lcs[i][j] is the length of the longest common subsequence of ma[i:] and mb[j:]
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		for i < n && j < m {
+			switch {
+			case ma[i] == mb[j]:
+				lines = append(lines, diffLine{' ', ma[i]})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lines = append(lines, diffLine{'-', ma[i]})
+				i++
+			default:
+				lines = append(lines, diffLine{'+', mb[j]})
+				j++
+			}
+		}
+	}
+	for _, l := range ma[i:] {
+		lines = append(lines, diffLine{'-', l})
+	}
+	for _, l := range mb[j:] {
+		lines = append(lines, diffLine{'+', l})
+	}
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	return lines
+}
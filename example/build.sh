@@ -7,21 +7,31 @@ cd `dirname "$0"` && cd ..
 function build_and_gen() {
    # build binary executable
     mkdir -p output/bin
-    rm -f output/bin/thriftgo-http-plugin
     go build -o output/bin/httpgen ./cmd/httpgen
     go build -o output/bin/combine ./cmd/combine
 
-    # generate code by thrift
-    output/bin/httpgen -handler handler.gen.go -router router.gen.go -output example/httpgen/http_gen example/example.thrift
-    output/bin/httpgen -handler handler.gen.go -router router.gen.go -output example/httpgen/http_gen example/another_example.thrift
+    # generate code of the thrift files in the config
+    output/bin/httpgen -config example/httpgen.yaml
 
     # combine multiple thrift files into one
     output/bin/combine -input_files example/example.thrift,example/another_example.thrift -output example/combine_service.thrift -namespace combine_service
 
-    # generate code by combined thrift file
-    output/bin/httpgen -handler handler.gen.go -router router.gen.go -output example/httpgen/http_gen -prefix github.com/sunyakun/thriftgo-tools/example/httpgen/http_gen example/combine_service.thrift
+    # generate code and a runnable server with the service stubs by combined thrift file
+    output/bin/httpgen -recursive -handler handler.gen.go -router router.gen.go -service service.gen.go -main example/httpgen/http_gen/server/main.go -output example/httpgen/http_gen -prefix github.com/sunyakun/thriftgo-tools/example/httpgen/http_gen example/combine_service.thrift
 
     go build -o output/bin/example-server ./example/httpgen/server
+    go build -o output/bin/combine-server ./example/httpgen/http_gen/server
+}
+
+# fail if the generated code is stale, nothing is written
+function check() {
+    mkdir -p output/bin
+    go build -o output/bin/httpgen ./cmd/httpgen
+    go build -o output/bin/combine ./cmd/combine
+
+    output/bin/httpgen -check -config example/httpgen.yaml
+    output/bin/combine -check -input_files example/example.thrift,example/another_example.thrift -output example/combine_service.thrift -namespace combine_service
+    output/bin/httpgen -check -recursive -handler handler.gen.go -router router.gen.go -service service.gen.go -main example/httpgen/http_gen/server/main.go -output example/httpgen/http_gen -prefix github.com/sunyakun/thriftgo-tools/example/httpgen/http_gen example/combine_service.thrift
 }
 
 function serve() {
@@ -32,6 +42,8 @@ function clean() {
   rm -rf example/httpgen/http_gen/example
   rm -rf example/httpgen/http_gen/another_example
   rm -rf example/httpgen/http_gen/combine_service
+  rm -rf example/httpgen/http_gen/server
+  rm -f example/httpgen/http_gen/.httpgen-manifest.json
   rm -f example/combine_service.thrift
 }
 
@@ -42,11 +54,14 @@ case $1 in
     "clean")
         clean
         ;;
+    "check")
+        check
+        ;;
     "serve")
         serve
         ;;
     "")
-        echo "Usage: ./build.sh [build|clean|serve]"
+        echo "Usage: ./build.sh [build|clean|serve|check]"
         exit 1
         ;;
 esac
\ No newline at end of file
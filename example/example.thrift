@@ -12,7 +12,7 @@ struct GetExampleRequest {
 }
 
 struct CreateExampleRequest {
-    1: required string name (api.vd="regexp('[a-zA-Z]{3,}', $)"),
+    1: required string name (api.vd="regexp('[a-zA-Z]{3,}', $)", api.vd_msg="name must have at least 3 letters"),
     2: required string address (api.vd="len($)<=255"),
     3: required i64 age (api.vd="$>=18"),
 }
@@ -10,7 +10,9 @@ import (
 func main() {
 	g := gin.Default()
 	service := biz.NewExampleService()
-	example.Register(g, service)
+	if _, err := example.Register(g, service); err != nil {
+		panic(err)
+	}
 	err := g.Run(":6789")
 	if err != nil {
 		panic(err)
@@ -4,12 +4,18 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"mime"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/cloudwego/thriftgo/generator/backend"
 	"github.com/cloudwego/thriftgo/generator/golang"
@@ -19,33 +25,254 @@ import (
 
 var Version = "0.0.1"
 
+// metadataPkgName is the package name of the http request metadata.
+const metadataPkgName = "httpmeta"
+
+// metadataPrefix prefixes the names of the metadata generated into the package of the handler.
+const metadataPrefix = "HTTPMeta"
+
+// redactStruct is a struct which has the Redacted method.
+type redactStruct struct {
+	Name   string
+	Fields []redactField
+}
+
+type redactField struct {
+	GoName    string
+	Mode      string // redact, mask or hash for the sensitive fields, nested or container for the nested structs
+	TypeName  string // the go type of the field
+	IsString  bool
+	IsPointer bool
+	Container *redactContainer
+}
+
+// redactContainer redacts the values of a container one by one into a new container, the values are the structs
+// which have the Redacted method or the containers of them.
+type redactContainer struct {
+	Src      string // the expression of the container, like p.Items
+	Dst      string // the expression of the redacted container, like r.Items
+	TypeName string // the go type of the container, like []*Item
+	Key      string // the loop variables
+	Value    string
+	Elem     *redactContainer // the container of the values, it's nil if the values are the structs
+}
+
+// jsConvStruct is a struct which has i64 fields encoded as strings.
+type jsConvStruct struct {
+	Name   string
+	Fields []jsConvField
+}
+
+type jsConvField struct {
+	GoName    string
+	JSONName  string
+	TypeName  string // the go type name without pointer
+	IsPointer bool
+	OmitEmpty bool
+}
+
 type Desc struct {
 	Version string
 	PkgPath string // package path like "github.com/cloudwego/thriftgo"
 	PkgName string // package name like "main"
 	Imports []string
+
+	// MetaImport is the import path of the http request metadata package and MetaPkg is its qualifier
+	// like "httpmeta.". If the metadata is generated into the same package, MetaImport is empty and MetaPkg is
+	// the prefix of the metadata names, so that they don't collide with the types of the thrift file.
+	MetaImport string
+	MetaPkg    string
+
+	OTel       bool // instrument the handlers with opentelemetry tracing and metrics
+	Prometheus bool // wrap the routes with prometheus collectors
+	RequestLog bool // log the requests and responses by the slog logger of the handler
 }
 
 func (d Desc) getTypeName(typeName string) string {
-	if d.PkgPath == "" || strings.Contains(typeName, ".") {
+	if d.PkgPath == "" {
 		return typeName
 	}
-	return d.PkgName + "." + typeName
+	// qualify the type names of the package in a composite type like []*Example
+	return typeNamePattern.ReplaceAllStringFunc(typeName, func(name string) string {
+		if strings.Contains(name, ".") {
+			return name
+		}
+		return d.PkgName + "." + name
+	})
 }
 
+// typeNamePattern matches the go type names generated by thriftgo, they're exported and may be qualified
+// by a package name, the builtin types like int64 and []byte are not matched.
+var typeNamePattern = regexp.MustCompile(`(\b[a-z_][a-zA-Z0-9_]*\.)?\b[A-Z][a-zA-Z0-9_]*`)
+
 type ServiceDesc struct {
 	Desc
+	ServiceName         string // the name of the service in thrift
 	ServiceTypeName     string
 	ServiceFunctionName string
 	Handlers            []HandlerDesc
+	// HandlerImports are the imports of the handler, it names the request types and only the response
+	// types whose fields are written apart from the body, while Imports are the ones of every type.
+	HandlerImports []string
+}
+
+// HasResponseFields reports whether any handler writes response fields as headers or cookies,
+// or encodes them as strings.
+func (s *ServiceDesc) HasResponseFields() bool {
+	for _, h := range s.Handlers {
+		for _, f := range h.ResponseFields {
+			if f.In != "http_code" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasOneway reports whether any handler calls a oneway function in the background.
+func (s *ServiceDesc) HasOneway() bool {
+	for _, h := range s.Handlers {
+		if h.Oneway {
+			return true
+		}
+	}
+	return false
+}
+
+// HasMiddlewares reports whether any route is wrapped by the middlewares from the registry.
+func (s *ServiceDesc) HasMiddlewares() bool {
+	for _, h := range s.Handlers {
+		if len(h.Middlewares) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTimeout reports whether any handler calls the service with a deadline.
+func (s *ServiceDesc) HasTimeout() bool {
+	for _, h := range s.Handlers {
+		if h.Timeout > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasMaxBody reports whether any handler limits the size of the request body.
+func (s *ServiceDesc) HasMaxBody() bool {
+	for _, h := range s.Handlers {
+		if h.MaxBody > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFileFields reports whether any handler binds uploaded files.
+func (s *ServiceDesc) HasFileFields() bool {
+	for _, h := range s.Handlers {
+		if h.HasFileFields() {
+			return true
+		}
+	}
+	return false
 }
 
 type HandlerDesc struct {
 	HTTPMethod       string
 	Route            string
 	HandlerFuncName  string
+	FunctionName     string // the name of the function in thrift
 	RequestTypeName  string
 	ResponseTypeName string
+	ResponseType     string // the go type returned by the service, like *Example, []*Example or string
+	RequestFields    []FieldDesc
+	ResponseFields   []ResponseFieldDesc // the response fields that are left out of the body or encoded as strings
+
+	// RequestSchema and ResponseSchema are the names of the request and response structs in the IR,
+	// ResponseSchema is empty if the response isn't a struct.
+	RequestSchema  string
+	ResponseSchema string
+	Annotations    map[string][]string // the annotations of the function in thrift
+
+	responseType string // the thrift type of the response in the IR, like list<example.Item>
+	rawBodyField string // the thrift field of the response struct written as the raw body
+
+	// RawBody is the expression of the response body when the response is a binary stream
+	// instead of json, ContentType and ContentDisposition are the headers of the stream.
+	RawBody            string
+	ContentType        string
+	ContentDisposition string
+
+	// Oneway handlers reply 202 Accepted and call the service in the background, there's no response.
+	Oneway bool
+
+	Middlewares []string      // the names of the middlewares in the registry passed to Register
+	Timeout     time.Duration // the deadline of the service call, it replies 504 when exceeded
+	MaxBody     int64         // the size limit of the request body, it replies 413 when exceeded
+
+	// LogRequest and LogResponse are the expressions of the logged request and response, they're the
+	// Redacted views if there are sensitive fields. LogResponse is empty if the response isn't logged.
+	LogRequest  string
+	LogResponse string
+	// RedactResponse redacts the container response into LogResponse before it's logged.
+	RedactResponse *redactContainer
+}
+
+// TimeoutExpr returns the go expression of the timeout, like 2 * time.Second.
+func (h HandlerDesc) TimeoutExpr() string {
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"}, {time.Minute, "time.Minute"}, {time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"}, {time.Microsecond, "time.Microsecond"},
+	}
+	for _, u := range units {
+		if h.Timeout%u.unit == 0 {
+			return fmt.Sprintf("%d * %s", h.Timeout/u.unit, u.name)
+		}
+	}
+	return fmt.Sprintf("%d * time.Nanosecond", h.Timeout)
+}
+
+// HasFileFields reports whether the request has any field bound from uploaded files.
+func (h HandlerDesc) HasFileFields() bool {
+	for _, f := range h.RequestFields {
+		if f.IsFile {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldDesc describes where a request field is bound from and the rule it is validated with.
+type FieldDesc struct {
+	GoName string
+	Name   string // the parameter name in its source, for body fields it's the json name
+	In     string // path, query, form, header, cookie or body
+	Rule   string
+
+	// the uploaded files bound from multipart/form-data, each of them must not be larger than MaxSize
+	IsFile   bool
+	IsList   bool
+	Required bool
+	MaxSize  int64
+
+	field string // the name of the field in thrift
+}
+
+// ResponseFieldDesc describes a response field which is written as a header, a cookie or the status code.
+type ResponseFieldDesc struct {
+	GoName    string
+	JSONName  string
+	Name      string // the header or cookie name
+	In        string // header, cookie, http_code or js_conv
+	IsPointer bool
+	OmitEmpty bool
+
+	field string // the name of the field in thrift
 }
 
 type Args struct {
@@ -55,8 +282,25 @@ type Args struct {
 	Module        string
 	PackagePrefix string
 	TemplateDir   string
+	MaxUploadSize string // the default size limit of an uploaded file, like "32MB"
+	JSConv        bool   // encode all the i64 fields as json strings
+	OTel          bool   // instrument the handlers with opentelemetry tracing and metrics
+	Prometheus    bool   // wrap the routes with prometheus collectors
+	RequestLog    bool   // log the requests and responses by log/slog, the sensitive fields are redacted
+	MainPath      string // the server entrypoint wiring the services, the service is added if the file exists
+	IRPath        string // the json intermediate representation of the services and the structs
+
+	// IncludesGenerated tells the included files are generated by other runs, their structs aren't patched
+	// but they're taken as patched, like the Redacted methods of them.
+	IncludesGenerated bool
+	// MetadataGenerated tells the shared metadata package under the output path is generated by GenerateMetadata,
+	// the handler imports it without generating it.
+	MetadataGenerated bool
 }
 
+// defaultMaxUploadSize is the size limit of an uploaded file if neither api.file_max nor Args.MaxUploadSize is given.
+const defaultMaxUploadSize = 32 << 20
+
 type Generator struct {
 	logfunc       backend.LogFunc
 	warns         []string
@@ -66,7 +310,13 @@ type Generator struct {
 	routerTpl     *template.Template
 	serviceTpl    *template.Template
 	routerBodyTpl *template.Template
+	mainTpl       *template.Template
 	tplFuncs      template.FuncMap
+	templateDir   string
+	maxUploadSize int64
+	jsConv        bool
+	importBase    string // the import path prefix of the thriftgo generated packages
+	redacted      map[*golang.StructLike]bool
 }
 
 func NewGenerator() *Generator {
@@ -80,6 +330,7 @@ func NewGenerator() *Generator {
 		MultiWarn: func(warns []string) { g.warns = append(g.warns, warns...) },
 	}
 	g.codeutils = golang.NewCodeUtils(g.logfunc)
+	g.maxUploadSize = defaultMaxUploadSize
 	g.tplFuncs = template.FuncMap{
 		"InsertionPoint": plugin.InsertionPoint,
 	}
@@ -88,25 +339,623 @@ func NewGenerator() *Generator {
 
 func (g *Generator) parseStructFieldAnnotation(annotations parser.Annotations) (string, error) {
 	tags := make([]string, 0)
+	var vd, vdMsg string
 	for _, a := range annotations {
 		if strings.HasPrefix(a.Key, "api.") {
 			switch strings.ToUpper(a.Key[4:]) {
-			case "PATH", "QUERY", "FORM", "COOKIE", "HEADER", "BODY", "VD":
+			case "PATH", "QUERY", "FORM", "COOKIE", "HEADER", "BODY":
 				tagName := strings.ToLower(a.Key[4:])
 				if tagName == "body" {
 					// body will use json tag and the thriftgo will generate it
 					continue
 				}
 				tags = append(tags, fmt.Sprintf("%s:\"%s\"", tagName, strings.Join(a.Values, ",")))
+			case "VD":
+				vd = strings.Join(a.Values, ",")
+			case "VD_MSG":
+				vdMsg = strings.Join(a.Values, ",")
+			case "HTTP_CODE", "FILE", "FILE_MAX", "JS_CONV", "TAG", "SENSITIVE":
+				// the status code of a response and the uploaded files are not bound by tags,
+				// the passthrough tags are merged by genFieldTag
+				continue
+			case "RAW_BODY":
+				tags = append(tags, "raw_body:\"\"")
 			default:
 				return "", fmt.Errorf("annotations %s is not support", a.Key)
 			}
 		}
 	}
 
+	if vdMsg != "" {
+		if vd == "" {
+			return "", errors.New("annotation api.vd_msg must be used together with api.vd")
+		}
+		// the message is a quoted string of the tag expression, see go-tagexpr validator
+		vd = fmt.Sprintf("@:%s; msg:'%s'", vd, strings.ReplaceAll(vdMsg, "'", "\\\\'"))
+	}
+	if vd != "" {
+		tags = append(tags, fmt.Sprintf("vd:\"%s\"", vd))
+	}
+
 	return strings.Join(tags, " "), nil
 }
 
+// structTag is a key:"value" pair of a go struct tag, Raw is the pair as it's written.
+type structTag struct {
+	Key   string
+	Value string
+	Raw   string
+}
+
+// parseStructTags splits the go struct tag into key:"value" pairs in the order they are written.
+func parseStructTags(tag string) ([]structTag, error) {
+	tags := make([]structTag, 0)
+	for tag = strings.TrimSpace(tag); tag != ""; tag = strings.TrimSpace(tag) {
+		i := strings.Index(tag, ":\"")
+		if i <= 0 || strings.ContainsAny(tag[:i], " \t\"`") {
+			return nil, fmt.Errorf("malformed struct tag '%s'", tag)
+		}
+		j := i + 2
+		for j < len(tag) && tag[j] != '"' {
+			if tag[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		if j >= len(tag) {
+			return nil, fmt.Errorf("malformed struct tag '%s'", tag)
+		}
+		value, err := strconv.Unquote(tag[i+1 : j+1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed struct tag '%s': %w", tag, err)
+		}
+		tags = append(tags, structTag{Key: tag[:i], Value: value, Raw: tag[:j+1]})
+		tag = tag[j+1:]
+	}
+	return tags, nil
+}
+
+func lookupStructTag(tags []structTag, key string) (structTag, bool) {
+	for _, t := range tags {
+		if t.Key == key {
+			return t, true
+		}
+	}
+	return structTag{}, false
+}
+
+// generatorFeatures parses the features of the go generator of thriftgo from its parameters, like
+// json_enum_as_text or gen_db_tag.
+func generatorFeatures(params []string) (golang.Features, error) {
+	cu := golang.NewCodeUtils(backend.DummyLogFunc())
+	if err := cu.HandleOptions(params); err != nil {
+		return golang.Features{}, fmt.Errorf("invalid parameters of the go generator: %w", err)
+	}
+	return cu.Features(), nil
+}
+
+// thriftgoTags returns the tags generated by thriftgo for the field, the annotation go.tag replaces the json tag.
+func (g *Generator) thriftgoTags(f *golang.Field) ([]structTag, error) {
+	tag, err := g.codeutils.GenTags(f.Field, "")
+	if err != nil {
+		return nil, err
+	}
+	return parseStructTags(strings.Trim(tag, "`"))
+}
+
+// jsonName returns the name of the field encoded by encoding/json and whether it's omitted when empty.
+func (g *Generator) jsonName(f *golang.Field) (string, bool, error) {
+	tags, err := g.thriftgoTags(f)
+	if err != nil {
+		return "", false, err
+	}
+	t, ok := lookupStructTag(tags, "json")
+	if !ok {
+		return f.GoName().String(), false, nil
+	}
+	opts := strings.Split(t.Value, ",")
+	name := opts[0]
+	if name == "" {
+		name = f.GoName().String()
+	}
+	for _, opt := range opts[1:] {
+		if opt == "omitempty" {
+			return name, true, nil
+		}
+	}
+	return name, false, nil
+}
+
+// genFieldTag merges the tags from the annotations of a field into the tags generated by thriftgo, a tag which
+// thriftgo already generates is dropped, and a key defined twice with different values is a conflict.
+func (g *Generator) genFieldTag(f *golang.Field) (string, error) {
+	tag, err := g.parseStructFieldAnnotation(f.Annotations)
+	if err != nil {
+		return "", err
+	}
+	custom := append([]string{tag}, f.Annotations.Get("api.tag")...)
+	jsConv, err := g.isJSConvField(f)
+	if err != nil {
+		return "", err
+	}
+	if jsConv {
+		custom = append(custom, "js_conv:\"true\"")
+	}
+
+	tags, err := parseStructTags(strings.Join(custom, " "))
+	if err != nil {
+		return "", fmt.Errorf("field '%s': %w", f.Name, err)
+	}
+	thriftTags, err := g.thriftgoTags(f)
+	if err != nil {
+		return "", err
+	}
+
+	merged := make([]string, 0, len(tags))
+	for i, t := range tags {
+		if prev, ok := lookupStructTag(tags[:i], t.Key); ok {
+			return "", fmt.Errorf("tag '%s' of field '%s' conflicts with '%s'", t.Raw, f.Name, prev.Raw)
+		}
+		if prev, ok := lookupStructTag(thriftTags, t.Key); ok {
+			if prev.Value != t.Value {
+				return "", fmt.Errorf("tag '%s' of field '%s' conflicts with '%s' generated by thriftgo, "+
+					"use annotation go.tag to replace it", t.Raw, f.Name, prev.Raw)
+			}
+			continue
+		}
+		merged = append(merged, t.Raw)
+	}
+	return strings.Join(merged, " "), nil
+}
+
+// parseRequestField finds out the source of a request field from its annotations.
+func (g *Generator) parseRequestField(f *golang.Field) (FieldDesc, error) {
+	name, _, err := g.jsonName(f)
+	if err != nil {
+		return FieldDesc{}, err
+	}
+	fd := FieldDesc{GoName: f.GoName().String(), Name: name, In: "body", field: f.Name}
+	for _, a := range f.Annotations {
+		if !strings.HasPrefix(a.Key, "api.") || len(a.Values) == 0 {
+			continue
+		}
+		switch key := strings.ToLower(a.Key[4:]); key {
+		case "path", "query", "form", "cookie", "header":
+			if fd.In == "body" {
+				fd.In, fd.Name = key, strings.Split(a.Values[0], ",")[0]
+			}
+		case "vd":
+			fd.Rule = strings.Join(a.Values, ",")
+		case "file":
+			switch {
+			case f.Type.Category == parser.Category_Binary:
+			case f.Type.Category == parser.Category_List && f.Type.ValueType.Category == parser.Category_Binary:
+				fd.IsList = true
+			default:
+				return fd, fmt.Errorf("field '%s' with annotation %s must be 'binary' or 'list<binary>'", f.Name, a.Key)
+			}
+			fd.IsFile, fd.In, fd.Name = true, "form", a.Values[0]
+			fd.Required = f.Requiredness == parser.FieldType_Required
+		}
+	}
+	if fd.IsFile {
+		fd.MaxSize = g.maxUploadSize
+		if max := f.Annotations.Get("api.file_max"); len(max) > 0 {
+			size, err := ParseSize(max[0])
+			if err != nil {
+				return fd, fmt.Errorf("annotation api.file_max of field '%s': %w", f.Name, err)
+			}
+			fd.MaxSize = size
+		}
+	}
+	return fd, nil
+}
+
+// ParseSize parses a size like "512KB" or "10MB" into bytes, the units are based on 1024.
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		unit   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.unit
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	return n * unit, nil
+}
+
+// parseResponseField returns the description of a response field if it's not a part of the body.
+func (g *Generator) parseResponseField(f *golang.Field) (*ResponseFieldDesc, error) {
+	name, _, err := g.jsonName(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range f.Annotations {
+		if !strings.HasPrefix(a.Key, "api.") {
+			continue
+		}
+		fd := &ResponseFieldDesc{
+			GoName:    f.GoName().String(),
+			JSONName:  name,
+			IsPointer: f.GoTypeName().IsPointer(),
+			field:     f.Name,
+		}
+		switch key := strings.ToLower(a.Key[4:]); key {
+		case "raw_body":
+			if f.Type.Category != parser.Category_Binary && f.Type.Category != parser.Category_String {
+				return nil, fmt.Errorf("field '%s' with annotation %s must be 'binary' or 'string'", f.Name, a.Key)
+			}
+			fd.In = key
+			return fd, nil
+		case "header", "cookie":
+			if len(a.Values) == 0 || a.Values[0] == "" {
+				return nil, fmt.Errorf("annotation %s of field '%s' requires a name", a.Key, f.Name)
+			}
+			fd.In, fd.Name = key, strings.Split(a.Values[0], ",")[0]
+			return fd, nil
+		case "http_code":
+			switch f.Type.Category {
+			case parser.Category_I16, parser.Category_I32, parser.Category_I64:
+			default:
+				return nil, fmt.Errorf("field '%s' with annotation %s must be an integer", f.Name, a.Key)
+			}
+			fd.In = key
+			return fd, nil
+		}
+	}
+	return nil, nil
+}
+
+// isJSConvField reports whether the field is an i64 encoded as json string, it's enabled by
+// the annotation api.js_conv or Args.JSConv.
+func (g *Generator) isJSConvField(f *golang.Field) (bool, error) {
+	enabled := g.jsConv
+	if v := f.Annotations.Get("api.js_conv"); len(v) > 0 {
+		b, err := strconv.ParseBool(v[0])
+		if err != nil {
+			return false, fmt.Errorf("annotation api.js_conv of field '%s': %w", f.Name, err)
+		}
+		if b && f.Type.Category != parser.Category_I64 {
+			return false, fmt.Errorf("field '%s' with annotation api.js_conv must be 'i64'", f.Name)
+		}
+		enabled = b
+	}
+	return enabled && f.Type.Category == parser.Category_I64, nil
+}
+
+// includedASTs returns the asts included by the ast directly or indirectly, each of them appears once.
+func includedASTs(ast *parser.Thrift) []*parser.Thrift {
+	asts := make([]*parser.Thrift, 0)
+	visited := map[string]bool{ast.Filename: true}
+	var walk func(*parser.Thrift)
+	walk = func(t *parser.Thrift) {
+		for _, include := range t.Includes {
+			if include.Reference == nil || visited[include.Reference.Filename] {
+				continue
+			}
+			visited[include.Reference.Filename] = true
+			asts = append(asts, include.Reference)
+			walk(include.Reference)
+		}
+	}
+	walk(ast)
+	return asts
+}
+
+// typeQualifier qualifies the types referenced by the functions of a service and its bases as they're
+// used in the package of the main scope, and collects the packages to import.
+type typeQualifier struct {
+	g       *Generator
+	scope   *golang.Scope
+	imports map[string]string // package name => import path
+}
+
+// qualify qualifies the type names in a go type which is generated in the scope from, like []*Example.
+func (q *typeQualifier) qualify(goType string, from *golang.Scope) (string, error) {
+	var err error
+	qualified := typeNamePattern.ReplaceAllStringFunc(goType, func(typeName string) string {
+		name, qerr := q.qualifyName(typeName, from)
+		if qerr != nil && err == nil {
+			err = qerr
+		}
+		return name
+	})
+	return qualified, err
+}
+
+func (q *typeQualifier) qualifyName(typeName string, from *golang.Scope) (string, error) {
+	pkg, name := "", typeName
+	if i := strings.LastIndex(typeName, "."); i >= 0 {
+		pkg, name = typeName[:i], typeName[i+1:]
+	}
+	var importPath string
+	if pkg == "" {
+		pkg = q.g.codeutils.GetPackageName(from.AST())
+		_, _, importPath = q.g.codeutils.ParseNamespace(from.AST())
+	} else {
+		for _, include := range from.Includes() {
+			if include != nil && include.PackageName == pkg {
+				importPath = include.ImportPath
+				break
+			}
+		}
+		if importPath == "" {
+			return "", fmt.Errorf("package of type '%s' not found in '%s'", typeName, from.AST().Filename)
+		}
+	}
+	if _, _, mainPath := q.g.codeutils.ParseNamespace(q.scope.AST()); importPath == mainPath {
+		return name, nil
+	}
+
+	if q.g.importBase == "" {
+		return "", fmt.Errorf("type '%s' is defined in '%s', package_prefix or module is required to import it",
+			typeName, from.AST().Filename)
+	}
+	importPath = q.g.importBase + "/" + importPath
+	if prev, ok := q.imports[pkg]; ok && prev != importPath {
+		return "", fmt.Errorf("package name '%s' of '%s' conflicts with '%s'", pkg, importPath, prev)
+	}
+	q.imports[pkg] = importPath
+	return pkg + "." + name, nil
+}
+
+// Imports returns the import paths of the qualified types in order.
+func (q *typeQualifier) Imports() []string {
+	imports := make([]string, 0, len(q.imports))
+	for _, importPath := range q.imports {
+		imports = append(imports, importPath)
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+// serviceFunctions returns the functions of the service and the ones inherited through extends, with the
+// scopes they're defined in. A function overridden by a child service is taken from the child.
+func serviceFunctions(svc *golang.Service) ([]*golang.Function, []*golang.Scope) {
+	funcs, scopes := make([]*golang.Function, 0), make([]*golang.Scope, 0)
+	defined := make(map[string]bool)
+	for ; svc != nil; svc = svc.Base() {
+		for _, f := range svc.Functions() {
+			if defined[f.Name] {
+				continue
+			}
+			defined[f.Name] = true
+			funcs, scopes = append(funcs, f), append(scopes, svc.From())
+		}
+	}
+	return funcs, scopes
+}
+
+// resolveTypedef follows the typedefs to the underlying type and the scope it's defined in,
+// the category of a typedef is already the underlying one so it's looked up by name.
+func resolveTypedef(scope *golang.Scope, t *parser.Type) (*golang.Scope, *parser.Type) {
+	for {
+		defined, alias := scope, t.Name
+		if ref := t.GetReference(); ref != nil {
+			include := scope.Includes().ByIndex(int(ref.Index))
+			if include == nil {
+				return scope, t
+			}
+			defined, alias = include.Scope, ref.Name
+		}
+		typedef := defined.Typedef(alias)
+		if typedef == nil {
+			return scope, t
+		}
+		scope, t = defined, typedef.Type
+	}
+}
+
+// sensitiveMode returns how the field is redacted by the annotation api.sensitive, it's empty if the field
+// isn't sensitive.
+func sensitiveMode(f *golang.Field) (string, error) {
+	v := f.Annotations.Get("api.sensitive")
+	if len(v) == 0 {
+		return "", nil
+	}
+	switch mode := strings.ToLower(v[0]); mode {
+	case "false":
+		return "", nil
+	case "true", "redact":
+		return "redact", nil
+	case "mask", "hash":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid annotation api.sensitive '%s' of field '%s', it should be true, mask or hash", v[0], f.Name)
+	}
+}
+
+// nestedStructLike returns the struct of the field and whether it's the value of a list, set or map, the nested
+// containers like list<list<Example>> are reported by depth greater than 1.
+func (g *Generator) nestedStructLike(scope *golang.Scope, t *parser.Type) (sl *golang.StructLike, container parser.Category, depth int) {
+	for {
+		scope, t = resolveTypedef(scope, t)
+		switch {
+		case t.Category.IsStructLike():
+			return g.getStructLike(scope, t), container, depth
+		case t.Category.IsList() || t.Category.IsSet() || t.Category.IsMap():
+			if depth == 0 {
+				container = t.Category
+			}
+			t, depth = t.ValueType, depth+1
+		default:
+			return nil, container, depth
+		}
+	}
+}
+
+// redactedStructs finds out the structs which have the Redacted method, a struct has it if any of its fields is
+// sensitive or nests a struct which has it, directly or as the values of a container.
+func (g *Generator) redactedStructs(scopes []*golang.Scope) (map[*golang.StructLike]bool, error) {
+	redacted := make(map[*golang.StructLike]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, scope := range scopes {
+			for _, sl := range scope.StructLikes() {
+				if redacted[sl] {
+					continue
+				}
+				for _, f := range sl.Fields() {
+					mode, err := sensitiveMode(f)
+					if err != nil {
+						return nil, err
+					}
+					if nested, _, _ := g.nestedStructLike(scope, f.Type); mode != "" || redacted[nested] {
+						redacted[sl], changed = true, true
+						break
+					}
+				}
+			}
+		}
+	}
+	return redacted, nil
+}
+
+// getRedactStruct returns the fields of the struct to be redacted by the Redacted method.
+func (g *Generator) getRedactStruct(scope *golang.Scope, sl *golang.StructLike) (*redactStruct, error) {
+	rs := &redactStruct{Name: sl.GoName().String()}
+	resolver := golang.NewResolver(scope, g.codeutils)
+	typeName := func(scope *golang.Scope, t *parser.Type) (string, error) {
+		name, err := resolver.GetTypeName(scope, t)
+		return string(name), err
+	}
+	for _, f := range sl.Fields() {
+		mode, err := sensitiveMode(f)
+		if err != nil {
+			return nil, err
+		}
+		_, t := resolveTypedef(scope, f.Type)
+		rf := redactField{
+			GoName:    f.GoName().String(),
+			Mode:      mode,
+			TypeName:  f.GoTypeName().String(),
+			IsString:  t.Category == parser.Category_String,
+			IsPointer: f.GoTypeName().IsPointer(),
+		}
+		if mode != "" {
+			if mode != "redact" && !rf.IsString {
+				return nil, fmt.Errorf("field '%s' with annotation api.sensitive '%s' must be 'string'", f.Name, mode)
+			}
+			rs.Fields = append(rs.Fields, rf)
+			continue
+		}
+
+		nested, _, depth := g.nestedStructLike(scope, f.Type)
+		if !g.redacted[nested] {
+			continue
+		}
+		if depth == 0 {
+			rf.Mode = "nested"
+		} else {
+			rf.Mode = "container"
+			rf.Container, err = g.getRedactContainer(scope, f.Type, "p."+rf.GoName, "r."+rf.GoName, 0, typeName)
+			if err != nil {
+				return nil, fmt.Errorf("redact field '%s': %w", f.Name, err)
+			}
+		}
+		rs.Fields = append(rs.Fields, rf)
+	}
+	return rs, nil
+}
+
+// getRedactContainer describes how the container t used in scope is redacted from src to dst, the containers
+// are named by typeName as they're used where the code is generated.
+func (g *Generator) getRedactContainer(scope *golang.Scope, t *parser.Type, src, dst string, depth int,
+	typeName func(*golang.Scope, *parser.Type) (string, error)) (*redactContainer, error) {
+	name, err := typeName(scope, t)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redactContainer{
+		Src:      src,
+		Dst:      dst,
+		TypeName: name,
+		Key:      fmt.Sprintf("k%d", depth),
+		Value:    fmt.Sprintf("v%d", depth),
+	}
+	scope, t = resolveTypedef(scope, t)
+	if _, vt := resolveTypedef(scope, t.ValueType); !vt.Category.IsStructLike() {
+		rc.Elem, err = g.getRedactContainer(scope, t.ValueType, rc.Value, dst+"["+rc.Key+"]", depth+1, typeName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// getStructLike returns the struct-like that the type t refers to, t must be used in scope.
+func (g *Generator) getStructLike(scope *golang.Scope, t *parser.Type) *golang.StructLike {
+	scope, t = resolveTypedef(scope, t)
+	if ref := t.GetReference(); ref != nil {
+		include := scope.Includes().ByIndex(int(ref.Index))
+		if include == nil {
+			return nil
+		}
+		return include.StructLike(ref.Name)
+	}
+	return scope.StructLike(t.Name)
+}
+
+// handlerStructs finds out the structs used by the handlers of the service in scope, they're the requests
+// and the responses of the functions and the structs nested in them, directly or as the values of a container.
+func (g *Generator) handlerStructs(scope *golang.Scope, scopes []*golang.Scope) map[*golang.StructLike]bool {
+	defined := make(map[*golang.StructLike]*golang.Scope)
+	for _, s := range scopes {
+		for _, sl := range s.StructLikes() {
+			defined[sl] = s
+		}
+	}
+	used := make(map[*golang.StructLike]bool)
+	var walk func(*golang.Scope, *parser.Type)
+	walk = func(scope *golang.Scope, t *parser.Type) {
+		sl, _, _ := g.nestedStructLike(scope, t)
+		if sl == nil || used[sl] {
+			return
+		}
+		used[sl] = true
+		for _, f := range sl.Fields() {
+			walk(defined[sl], f.Type)
+		}
+	}
+	for _, svc := range scope.Services() {
+		funcs, from := serviceFunctions(svc)
+		for i, f := range funcs {
+			for _, arg := range f.Arguments() {
+				walk(from[i], arg.Type)
+			}
+			if !f.Void {
+				walk(from[i], f.FunctionType)
+			}
+		}
+	}
+	return used
+}
+
+// hasPatchs reports whether the struct has fields to be patched into the thriftgo generated code.
+func (g *Generator) hasPatchs(sl *golang.StructLike) (bool, error) {
+	for _, f := range sl.Fields() {
+		tag, err := g.genFieldTag(f)
+		if err != nil {
+			return false, err
+		}
+		jsConv, err := g.isJSConvField(f)
+		if err != nil {
+			return false, err
+		}
+		if tag != "" || jsConv {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (g *Generator) parseServiceFuncAnnotation(annotations parser.Annotations, handler *HandlerDesc) error {
 	for _, a := range annotations {
 		if strings.HasPrefix(a.Key, "api.") {
@@ -115,31 +964,151 @@ func (g *Generator) parseServiceFuncAnnotation(annotations parser.Annotations, h
 			case "GET", "PUT", "POST", "DELETE":
 				handler.HTTPMethod = method
 				handler.Route = a.Values[0]
+			case "CONTENT_TYPE":
+				handler.ContentType = a.Values[0]
+			case "FILENAME", "DISPOSITION":
+				// handled after all the annotations are parsed
+			case "MIDDLEWARE":
+				for _, v := range a.Values {
+					for _, name := range strings.Split(v, ",") {
+						if name = strings.TrimSpace(name); name != "" {
+							handler.Middlewares = append(handler.Middlewares, name)
+						}
+					}
+				}
+			case "TIMEOUT":
+				timeout, err := time.ParseDuration(a.Values[0])
+				if err != nil || timeout <= 0 {
+					return fmt.Errorf("invalid annotation %s '%s', it should be a positive duration like 2s", a.Key, a.Values[0])
+				}
+				handler.Timeout = timeout
+			case "MAX_BODY":
+				maxBody, err := ParseSize(a.Values[0])
+				if err != nil {
+					return fmt.Errorf("annotation %s: %w", a.Key, err)
+				}
+				handler.MaxBody = maxBody
 			default:
 				return fmt.Errorf("annotations %s is not support", a.Key)
 			}
 		}
 	}
+
+	filename, disposition := annotations.Get("api.filename"), annotations.Get("api.disposition")
+	if len(filename) > 0 || len(disposition) > 0 {
+		typ, params := "attachment", map[string]string{}
+		if len(disposition) > 0 {
+			typ = disposition[0]
+		}
+		if len(filename) > 0 {
+			params["filename"] = filename[0]
+		}
+		handler.ContentDisposition = mime.FormatMediaType(typ, params)
+		if handler.ContentDisposition == "" {
+			return fmt.Errorf("invalid content disposition '%s' with filename '%s'", typ, params["filename"])
+		}
+	}
 	return nil
 }
 
-func (g *Generator) genPatchs(scope *golang.Scope) ([]*plugin.Generated, error) {
+func (g *Generator) genPatchs(scope *golang.Scope, outputPath string) ([]*plugin.Generated, error) {
 	patchs := make([]*plugin.Generated, 0)
+	jsConvStructs := make([]jsConvStruct, 0)
+	redactStructs := make([]redactStruct, 0)
 	for _, sl := range scope.StructLikes() {
+		jsConvFields := make([]jsConvField, 0)
 		for _, f := range sl.Fields() {
-			tag, err := g.parseStructFieldAnnotation(f.Annotations)
+			tag, err := g.genFieldTag(f)
 			if err != nil {
 				return nil, err
 			}
-			insertionPoint := strings.Join([]string{sl.Category, sl.Name, f.Name, "tag"}, ".")
+			jsConv, err := g.isJSConvField(f)
 			if err != nil {
 				return nil, err
 			}
+			if jsConv {
+				name, omitEmpty, err := g.jsonName(f)
+				if err != nil {
+					return nil, err
+				}
+				jsConvFields = append(jsConvFields, jsConvField{
+					GoName:    f.GoName().String(),
+					JSONName:  name,
+					TypeName:  f.GoTypeName().Deref().String(),
+					IsPointer: f.GoTypeName().IsPointer(),
+					OmitEmpty: omitEmpty,
+				})
+			}
+			if tag == "" {
+				continue
+			}
+			insertionPoint := strings.Join([]string{sl.Category, sl.Name, f.Name, "tag"}, ".")
 			patchs = append(patchs, &plugin.Generated{
 				Content:        " " + tag,
 				InsertionPoint: &insertionPoint,
 			})
 		}
+		if len(jsConvFields) > 0 {
+			jsConvStructs = append(jsConvStructs, jsConvStruct{Name: sl.GoName().String(), Fields: jsConvFields})
+		}
+		if g.redacted[sl] {
+			rs, err := g.getRedactStruct(scope, sl)
+			if err != nil {
+				return nil, err
+			}
+			redactStructs = append(redactStructs, *rs)
+		}
+	}
+
+	if len(jsConvStructs) > 0 {
+		tpl, err := g.loadTemplate("js_conv.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, jsConvStructs); err != nil {
+			return nil, err
+		}
+		importsPoint, eofPoint := "imports", "eof"
+		patchs = append(patchs, &plugin.Generated{
+			Content:        "jsconvjson \"encoding/json\"\njsconvstrconv \"strconv\"\n",
+			InsertionPoint: &importsPoint,
+		}, &plugin.Generated{
+			Content:        buf.String(),
+			InsertionPoint: &eofPoint,
+		})
+	}
+	if len(redactStructs) > 0 {
+		tpl, err := g.loadTemplate("redact.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, redactStructs); err != nil {
+			return nil, err
+		}
+		var imports string
+		for _, rs := range redactStructs {
+			for _, f := range rs.Fields {
+				if f.Mode == "hash" && !strings.Contains(imports, "redactsha256") {
+					imports += "redactsha256 \"crypto/sha256\"\nredacthex \"encoding/hex\"\n"
+				} else if f.Mode == "mask" && !strings.Contains(imports, "redactstrings") {
+					imports += "redactstrings \"strings\"\n"
+				}
+			}
+		}
+		importsPoint, eofPoint := "imports", "eof"
+		if imports != "" {
+			patchs = append(patchs, &plugin.Generated{Content: imports, InsertionPoint: &importsPoint})
+		}
+		patchs = append(patchs, &plugin.Generated{
+			Content:        buf.String(),
+			InsertionPoint: &eofPoint,
+		})
+	}
+	if len(patchs) > 0 {
+		// the patchs without name are applied to the last named file
+		patchs[0].Name = &outputPath
 	}
 	return patchs, nil
 }
@@ -156,8 +1125,13 @@ func (g *Generator) getServiceDesc(scope *golang.Scope, desc Desc) (*ServiceDesc
 		return nil, errors.New("there should have only one service defined in a thrift file.")
 	}
 
+	s.ServiceName = scope.Services()[0].Name
 	s.ServiceTypeName = desc.getTypeName(scope.Services()[0].GoName().String())
-	for _, f := range scope.Services()[0].Functions() {
+	qualifier := &typeQualifier{g: g, scope: scope, imports: make(map[string]string)}
+	handlerQualifier := &typeQualifier{g: g, scope: scope, imports: make(map[string]string)}
+	funcs, scopes := serviceFunctions(scope.Services()[0])
+	for i, f := range funcs {
+		from := scopes[i]
 		handler := HandlerDesc{}
 		err := g.parseServiceFuncAnnotation(f.Annotations, &handler)
 		if err != nil {
@@ -165,16 +1139,171 @@ func (g *Generator) getServiceDesc(scope *golang.Scope, desc Desc) (*ServiceDesc
 		}
 
 		handler.HandlerFuncName = f.GoName().String()
-		handler.RequestTypeName = desc.getTypeName(f.Arguments()[0].GoTypeName().Deref().String())
-		handler.ResponseTypeName = desc.getTypeName(f.ResponseGoTypeName().Deref().String())
-		if handler.ResponseTypeName == "" {
+		handler.FunctionName = f.Name
+		handler.Annotations = annotationMap(f.Annotations)
+		reqTypeName, err := qualifier.qualify(f.Arguments()[0].GoTypeName().Deref().String(), from)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := handlerQualifier.qualify(f.Arguments()[0].GoTypeName().Deref().String(), from); err != nil {
+			return nil, err
+		}
+		handler.RequestTypeName = desc.getTypeName(reqTypeName)
+		handler.LogRequest = "&req"
+		if sl := g.getStructLike(from, f.Arguments()[0].Type); sl != nil {
+			handler.RequestSchema = g.schemaName(from, f.Arguments()[0].Type, sl)
+			if g.redacted[sl] {
+				handler.LogRequest = "req.Redacted()"
+			}
+			for _, field := range sl.Fields() {
+				fd, err := g.parseRequestField(field)
+				if err != nil {
+					return nil, err
+				}
+				handler.RequestFields = append(handler.RequestFields, fd)
+			}
+		}
+		if f.Oneway {
+			handler.Oneway = true
+			s.Handlers = append(s.Handlers, handler)
+			continue
+		}
+		if f.Void {
 			return nil, fmt.Errorf("function '%s' return type can't not be 'void'", f.Name)
 		}
+		respType, err := qualifier.qualify(f.ResponseGoTypeName().String(), from)
+		if err != nil {
+			return nil, err
+		}
+		handler.ResponseType = desc.getTypeName(respType)
+		handler.ResponseTypeName = strings.TrimPrefix(handler.ResponseType, "*")
+		handler.responseType = g.irTypeName(from, f.FunctionType)
+		if sl := g.getStructLike(from, f.FunctionType); sl != nil {
+			handler.ResponseSchema = g.schemaName(from, f.FunctionType, sl)
+			// the i64 fields encoded as strings should be shadowed too if the body is wrapped
+			jsConvFields := make([]ResponseFieldDesc, 0)
+			for _, field := range sl.Fields() {
+				fd, err := g.parseResponseField(field)
+				if err != nil {
+					return nil, err
+				}
+				if fd == nil {
+					jsConv, err := g.isJSConvField(field)
+					if err != nil {
+						return nil, err
+					}
+					if jsConv {
+						name, omitEmpty, err := g.jsonName(field)
+						if err != nil {
+							return nil, err
+						}
+						jsConvFields = append(jsConvFields, ResponseFieldDesc{
+							GoName:    field.GoName().String(),
+							JSONName:  name,
+							In:        "js_conv",
+							IsPointer: field.GoTypeName().IsPointer(),
+							OmitEmpty: omitEmpty,
+						})
+					}
+				} else if fd.In == "raw_body" {
+					handler.RawBody = "resp." + field.Getter().String() + "()"
+					handler.rawBodyField = field.Name
+					if field.Type.Category == parser.Category_String {
+						handler.RawBody = "[]byte(" + handler.RawBody + ")"
+					}
+				} else {
+					handler.ResponseFields = append(handler.ResponseFields, *fd)
+				}
+			}
+			if len(handler.ResponseFields) > 0 {
+				handler.ResponseFields = append(handler.ResponseFields, jsConvFields...)
+				if _, err := handlerQualifier.qualify(f.ResponseGoTypeName().String(), from); err != nil {
+					return nil, err
+				}
+			}
+		} else if _, t := resolveTypedef(from, f.FunctionType); t.Category == parser.Category_Binary {
+			handler.RawBody = "resp"
+		}
+		if handler.RawBody != "" && handler.ContentType == "" {
+			handler.ContentType = "application/octet-stream"
+		}
+		// the binary streams aren't logged, the responses nesting sensitive fields are redacted
+		nested, _, depth := g.nestedStructLike(from, f.FunctionType)
+		switch {
+		case handler.RawBody != "":
+		case !g.redacted[nested]:
+			handler.LogResponse = "resp"
+		case depth == 0:
+			handler.LogResponse = "resp.Redacted()"
+		default:
+			resolver := golang.NewResolver(from, g.codeutils)
+			typeName := func(scope *golang.Scope, t *parser.Type) (string, error) {
+				name, err := resolver.GetTypeName(scope, t)
+				if err != nil {
+					return "", err
+				}
+				return handlerQualifier.qualify(string(name), from)
+			}
+			handler.RedactResponse, err = g.getRedactContainer(from, f.FunctionType, "resp", "redacted", 0, typeName)
+			if err != nil {
+				return nil, fmt.Errorf("redact response of function '%s': %w", f.Name, err)
+			}
+			handler.LogResponse = "redacted"
+		}
 		s.Handlers = append(s.Handlers, handler)
 	}
+	s.Imports = append(s.Imports, qualifier.Imports()...)
+	s.HandlerImports = append(s.HandlerImports, handlerQualifier.Imports()...)
 	return s, nil
 }
 
+// genMetadata generates the http request metadata package used by the handler, it's shared under the
+// output path if the generated packages can be imported, or generated next to the handler. The shared one
+// isn't generated if it's generated already.
+func (g *Generator) genMetadata(outputPath, handlerName string, desc *Desc, generated bool) ([]*plugin.Generated, error) {
+	if g.importBase == "" {
+		desc.MetaPkg = metadataPrefix
+		metadata, err := g.execMetadata(path.Join(path.Dir(handlerName), metadataPkgName+".gen.go"),
+			Desc{Version: desc.Version, PkgName: desc.PkgName, MetaPkg: metadataPrefix})
+		if err != nil {
+			return nil, err
+		}
+		return []*plugin.Generated{metadata}, nil
+	}
+
+	desc.MetaImport, desc.MetaPkg = g.importBase+"/"+metadataPkgName, metadataPkgName+"."
+	if generated {
+		return nil, nil
+	}
+	metadata, err := g.execMetadata(path.Join(outputPath, metadataPkgName, metadataPkgName+".go"),
+		Desc{Version: desc.Version, PkgName: metadataPkgName})
+	if err != nil {
+		return nil, err
+	}
+	return []*plugin.Generated{metadata}, nil
+}
+
+// GenerateMetadata generates the http request metadata package shared by the handlers generated into the output
+// path, so that it's generated once for them rather than by every thrift file, see Args.MetadataGenerated.
+func GenerateMetadata(templateDir, outputPath string) (*plugin.Generated, error) {
+	g := NewGenerator()
+	g.templateDir = templateDir
+	return g.execMetadata(path.Join(outputPath, metadataPkgName, metadataPkgName+".go"),
+		Desc{Version: Version, PkgName: metadataPkgName})
+}
+
+func (g *Generator) execMetadata(name string, desc Desc) (*plugin.Generated, error) {
+	tpl, err := g.loadTemplate("metadata.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, desc); err != nil {
+		return nil, err
+	}
+	return &plugin.Generated{Name: &name, Content: buf.String()}, nil
+}
+
 func (g *Generator) genHandler(scope *golang.Scope, name string, desc Desc) ([]*plugin.Generated, error) {
 	srvDesc, err := g.getServiceDesc(scope, desc)
 	if err != nil {
@@ -201,8 +1330,6 @@ func (g *Generator) genRouter(scope *golang.Scope, name string, desc Desc) ([]*p
 		return nil, err
 	}
 
-	srvDesc.Desc = desc
-
 	finfo, err := os.Stat(name)
 	if errors.Is(err, os.ErrNotExist) || finfo.IsDir() {
 		writer := bytes.NewBuffer(make([]byte, 0, 1024))
@@ -225,6 +1352,10 @@ func (g *Generator) genRouter(scope *golang.Scope, name string, desc Desc) ([]*p
 		if begin == -1 || end == -1 {
 			return nil, errors.New("comment '// @route_gen begin' or '// @route_gen end' not found")
 		}
+		// the line break before the end comment is kept like the template, so regenerating is stable
+		if nl := strings.LastIndex(fs[:end], "\n"); nl > begin {
+			end = nl
+		}
 
 		generateds = append(generateds, &plugin.Generated{
 			Name:    &name,
@@ -236,6 +1367,7 @@ func (g *Generator) genRouter(scope *golang.Scope, name string, desc Desc) ([]*p
 	if err := g.routerBodyTpl.Execute(writer, map[string]interface{}{
 		"Handlers":        srvDesc.Handlers,
 		"ServiceTypeName": srvDesc.ServiceTypeName,
+		"Prometheus":      srvDesc.Prometheus,
 	}); err != nil {
 		return nil, err
 	}
@@ -254,21 +1386,286 @@ func (g *Generator) genService(scope *golang.Scope, name string, desc Desc) ([]*
 		return nil, err
 	}
 
-	srvDesc.Desc = desc
-
 	writer := bytes.NewBuffer(make([]byte, 0, 1024))
 	if err := g.serviceTpl.Execute(writer, srvDesc); err != nil {
 		return nil, err
 	}
+	content := writer.String()
+
+	// the service has the biz code once it's generated, only the stubs of the new functions are appended
+	fb, err := ioutil.ReadFile(name)
+	if err == nil {
+		fs := string(fb)
+		for _, h := range srvDesc.Handlers {
+			decl := "func (s *Service) " + h.HandlerFuncName + "("
+			begin := strings.Index(content, decl)
+			if begin == -1 || strings.Contains(fs, decl) {
+				continue
+			}
+			end := strings.Index(content[begin:], "\n}\n")
+			if end == -1 {
+				return nil, fmt.Errorf("the stub of '%s' in template service.tmpl doesn't end with '}'", h.HandlerFuncName)
+			}
+			fs = strings.TrimRight(fs, "\n") + "\n\n" + content[begin:begin+end+3]
+		}
+		content = fs
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
 
 	return []*plugin.Generated{
 		{
 			Name:    &name,
-			Content: writer.String(),
+			Content: content,
 		},
 	}, nil
 }
 
+// genOutputs generates the outputs of the template directory, the builtin ones are generated with the merging of
+// their own and the others by the overwrite policies.
+func (g *Generator) genOutputs(outputs []OutputSpec, req *plugin.Request, args *Args, scope *golang.Scope,
+	scopes []*golang.Scope, desc Desc) ([]*plugin.Generated, error) {
+	pkg := desc.PkgName
+	pathDesc := OutputPathDesc{PkgName: pkg, FileName: schemaFileName(scope.AST())}
+	if len(scope.Services()) > 0 {
+		pathDesc.ServiceName = scope.Services()[0].Name
+	}
+	names := make(map[string]string, len(outputs))
+	for _, o := range outputs {
+		name, err := o.outputName(req.OutputPath, pathDesc)
+		if err != nil {
+			return nil, err
+		}
+		names[o.Template] = name
+	}
+
+	generateds := make([]*plugin.Generated, 0, len(outputs))
+	var srvDesc *ServiceDesc
+	var ir *IR
+	for _, o := range outputs {
+		var err error
+		name := names[o.Template]
+		if o.Per == PerService && len(scope.Services()) == 0 {
+			continue
+		}
+		if o.builtin() {
+			// the builtin outputs except the main declare the package of the thrift file
+			if o.Path != "" && o.Template != MainTemplate {
+				rel, err := o.outputPath(pathDesc)
+				if err != nil {
+					return nil, err
+				}
+				if err := g.validateOutputPath(rel, pkg); err != nil {
+					return nil, fmt.Errorf("%s of template %s: %w", TemplateManifestFile, o.Template, err)
+				}
+			}
+			builtins, err := g.genBuiltin(o.Template, name, names, req, args, scope, &desc)
+			if err != nil {
+				return nil, err
+			}
+			generateds = append(generateds, builtins...)
+			continue
+		}
+
+		var data interface{}
+		switch o.Per {
+		case PerService:
+			if srvDesc == nil {
+				if srvDesc, err = g.getServiceDesc(scope, desc); err != nil {
+					return nil, err
+				}
+			}
+			data = srvDesc
+		case PerFile:
+			if ir == nil {
+				if ir, err = g.getIR(scope, scopes, desc); err != nil {
+					return nil, err
+				}
+			}
+			data = ir
+		}
+
+		tpl, err := g.parseTemplate(args.TemplateDir, o.Template)
+		if err != nil {
+			return nil, err
+		}
+		writer := bytes.NewBuffer(make([]byte, 0, 1024))
+		if err := tpl.Execute(writer, data); err != nil {
+			return nil, err
+		}
+		content := writer.String()
+
+		// the existing file is generated again as it is, or it'd be taken as stale
+		fb, err := ioutil.ReadFile(name)
+		if err == nil {
+			switch o.Overwrite {
+			case OverwriteCreateOnly:
+				content = string(fb)
+			case OverwriteMerge:
+				if content, err = replaceGenBlocks(string(fb), content); err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		generateds = append(generateds, &plugin.Generated{Name: &name, Content: content})
+	}
+	return generateds, nil
+}
+
+// genBuiltin generates the output of a builtin template into the file, names are the files of the outputs by
+// their templates. The handler sets the metadata package of desc.
+func (g *Generator) genBuiltin(tplName, name string, names map[string]string, req *plugin.Request, args *Args,
+	scope *golang.Scope, desc *Desc) ([]*plugin.Generated, error) {
+	var err error
+	switch tplName {
+	case HandlerTemplate:
+		if g.handlerTpl, err = g.parseHandlerTemplate(args.TemplateDir); err != nil {
+			return nil, err
+		}
+		metadata, err := g.genMetadata(req.OutputPath, name, desc, args.MetadataGenerated)
+		if err != nil {
+			return nil, err
+		}
+		handlers, err := g.genHandler(scope, name, *desc)
+		if err != nil {
+			return nil, err
+		}
+		return append(metadata, handlers...), nil
+	case RouterTemplate:
+		if g.routerTpl, err = g.parseTemplate(args.TemplateDir, RouterTemplate); err != nil {
+			return nil, err
+		}
+		if g.routerBodyTpl, err = g.parseTemplate(args.TemplateDir, "router_body.tmpl"); err != nil {
+			return nil, err
+		}
+		return g.genRouter(scope, name, *desc)
+	case ServiceTemplate:
+		if g.serviceTpl, err = g.parseTemplate(args.TemplateDir, ServiceTemplate); err != nil {
+			return nil, err
+		}
+		return g.genService(scope, name, *desc)
+	case MainTemplate:
+		service, ok := names[ServiceTemplate]
+		if !ok || path.Dir(service) != path.Join(req.OutputPath, desc.PkgName) {
+			return nil, errors.New("the main registers the generated Service, generate it into the package by 'service'")
+		}
+		if g.importBase == "" {
+			return nil, errors.New("the main imports the generated package, 'module' or 'package_prefix' is required")
+		}
+		if g.mainTpl, err = g.parseTemplate(args.TemplateDir, MainTemplate); err != nil {
+			return nil, err
+		}
+		srvDesc, err := g.getServiceDesc(scope, *desc)
+		if err != nil {
+			return nil, err
+		}
+		return g.genMain(name, MainDesc{
+			Version: Version,
+			Services: []MainServiceDesc{{
+				PkgName:    desc.PkgName,
+				ImportPath: g.importBase + "/" + path.Dir(g.codeutils.GetFilePath(req.AST)),
+				HasOneway:  srvDesc.HasOneway(),
+				Prometheus: args.Prometheus,
+			}},
+		})
+	}
+	return nil, fmt.Errorf("unknown builtin template %s", tplName)
+}
+
+// MainDesc is the data of the main template.
+type MainDesc struct {
+	Version  string
+	Services []MainServiceDesc
+}
+
+// MainServiceDesc is a service wired by the main, it's registered with the Service generated into its package.
+type MainServiceDesc struct {
+	PkgName    string
+	ImportPath string
+	HasOneway  bool // the handler runs the oneway functions on a worker pool to be drained on shutdown
+	Prometheus bool // the collectors are registered and exposed by the main
+}
+
+// mainBlocks are the generated blocks of the main, the lines of a new service are appended to them.
+var mainBlocks = []string{"import_gen", "register_gen"}
+
+func (g *Generator) genMain(name string, desc MainDesc) ([]*plugin.Generated, error) {
+	writer := bytes.NewBuffer(make([]byte, 0, 1024))
+	if err := g.mainTpl.Execute(writer, desc); err != nil {
+		return nil, err
+	}
+	content := writer.String()
+
+	fb, err := ioutil.ReadFile(name)
+	if err == nil {
+		if content, err = mergeGenBlocks(string(fb), content, mainBlocks); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return []*plugin.Generated{
+		{
+			Name:    &name,
+			Content: content,
+		},
+	}, nil
+}
+
+// MergeMain adds the services of the generated main to the existing one like the generation does,
+// so that the mains generated for several thrift files can be merged without writing them.
+func MergeMain(existing, generated string) (string, error) {
+	return mergeGenBlocks(existing, generated, mainBlocks)
+}
+
+// genBlock returns the range of the lines in the block of s, between the comments '// @<block> begin'
+// and '// @<block> end'.
+func genBlock(s, block string) (begin, end int, err error) {
+	begin = strings.Index(s, "// @"+block+" begin")
+	end = strings.Index(s, "// @"+block+" end")
+	if begin == -1 || end == -1 || end < begin {
+		return 0, 0, fmt.Errorf("comment '// @%s begin' or '// @%s end' not found", block, block)
+	}
+	begin += strings.Index(s[begin:], "\n") + 1
+	end = strings.LastIndex(s[:end], "\n") + 1
+	return begin, end, nil
+}
+
+// mergeGenBlocks appends the lines of the blocks in generated to the blocks in existing if they're missing,
+// a block is the lines between the comments '// @<block> begin' and '// @<block> end'.
+func mergeGenBlocks(existing, generated string, blocks []string) (string, error) {
+	for _, block := range blocks {
+		gb, ge, err := genBlock(generated, block)
+		if err != nil {
+			return "", err
+		}
+		eb, ee, err := genBlock(existing, block)
+		if err != nil {
+			return "", err
+		}
+
+		added := ""
+		present := strings.Split(existing[eb:ee], "\n")
+		for _, line := range strings.SplitAfter(generated[gb:ge], "\n") {
+			found := false
+			for _, p := range present {
+				if strings.TrimSpace(p) == strings.TrimSpace(line) {
+					found = true
+					break
+				}
+			}
+			if !found && strings.TrimSpace(line) != "" {
+				added += line
+			}
+		}
+		existing = existing[:ee] + added + existing[ee:]
+	}
+	return existing, nil
+}
+
 func (g *Generator) validateOutputPath(outPath, expectPkg string) error {
 	if path.IsAbs(outPath) {
 		// if absolute path convert it to relative path
@@ -293,31 +1690,53 @@ func (g *Generator) validateOutputPath(outPath, expectPkg string) error {
 	return nil
 }
 
-func (g *Generator) LoadTemplates(dir string) (handlerTpl, routerTpl, routerBodyTpl, serviceTpl *template.Template, err error) {
-	handlerTpl, err = template.New("handler.tmpl").Funcs(g.tplFuncs).ParseFiles(filepath.Join(dir, "handler.tmpl"))
+// loadTemplate parses the template in the template directory, the builtin one of gin is used if the directory
+// doesn't have it, like the directories copied before the template is added.
+func (g *Generator) loadTemplate(name string) (*template.Template, error) {
+	text, err := g.readTemplate(name)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, err
 	}
+	return template.New(name).Funcs(g.tplFuncs).Parse(string(text))
+}
 
-	routerTpl, err = template.New("router.tmpl").Funcs(g.tplFuncs).ParseFiles(filepath.Join(dir, "router.tmpl"))
-	if err != nil {
-		return nil, nil, nil, nil, err
+func (g *Generator) readTemplate(name string) ([]byte, error) {
+	text, err := ioutil.ReadFile(filepath.Join(g.templateDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		text, err = fs.ReadFile(Templates, path.Join("templates", "gin", name))
 	}
+	return text, err
+}
 
-	routerBodyTpl, err = template.New("router_body.tmpl").Funcs(g.tplFuncs).ParseFiles(filepath.Join(dir, "router_body.tmpl"))
+// parseHandlerTemplate parses the handler template with the templates it shares with the Redacted methods,
+// like redact_container, they're defined in redact.tmpl.
+func (g *Generator) parseHandlerTemplate(dir string) (*template.Template, error) {
+	tpl, err := g.parseTemplate(dir, HandlerTemplate)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, err
 	}
-
-	serviceTpl, err = template.New("service.tmpl").Funcs(g.tplFuncs).ParseFiles(filepath.Join(dir, "service.tmpl"))
+	text, err := g.readTemplate("redact.tmpl")
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, err
 	}
+	if _, err := tpl.New("redact.tmpl").Parse(string(text)); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
 
-	return
+// parseTemplate parses the template in the directory with the functions of the generator.
+func (g *Generator) parseTemplate(dir, name string) (*template.Template, error) {
+	return template.New(filepath.Base(name)).Funcs(g.tplFuncs).ParseFiles(filepath.Join(dir, name))
 }
 
 func (g *Generator) Execute(req *plugin.Request, args *Args) (*plugin.Response, error) {
+	// the tags and the types of the fields are the ones thriftgo generates with its parameters
+	features, err := generatorFeatures(req.GeneratorParameters)
+	if err != nil {
+		return nil, err
+	}
+	g.codeutils.SetFeatures(features)
 	scope, err := golang.BuildScope(g.codeutils, req.AST)
 	if err != nil {
 		return nil, err
@@ -337,20 +1756,18 @@ func (g *Generator) Execute(req *plugin.Request, args *Args) (*plugin.Response,
 		return nil, err
 	}
 
-	g.handlerTpl, g.routerTpl, g.routerBodyTpl, g.serviceTpl, err = g.LoadTemplates(args.TemplateDir)
-	if err != nil {
+	if err := g.validateOutputPath(args.IRPath, pkg); err != nil {
 		return nil, err
 	}
 
-	var imports []string
-	// FIXME: the ImportPath may include no need package
-	if args.PackagePrefix != "" && path.Dir(args.HandlerPath) != "." {
-		for _, include := range scope.Includes() {
-			imports = append(imports, args.PackagePrefix+"/"+include.ImportPath)
+	g.jsConv, g.templateDir = args.JSConv, args.TemplateDir
+	if args.MaxUploadSize != "" {
+		if g.maxUploadSize, err = ParseSize(args.MaxUploadSize); err != nil {
+			return nil, err
 		}
 	}
 
-	desc := Desc{Version: Version, PkgName: pkg, Imports: imports}
+	desc := Desc{Version: Version, PkgName: pkg, OTel: args.OTel, Prometheus: args.Prometheus, RequestLog: args.RequestLog}
 	if args.Module != "" {
 		out := strings.TrimLeft(req.OutputPath, "./")
 		desc.PkgPath = fmt.Sprintf("\"%s/%s/%s\"", args.Module, out, pkg)
@@ -358,58 +1775,93 @@ func (g *Generator) Execute(req *plugin.Request, args *Args) (*plugin.Response,
 		desc.PkgPath = ""
 	}
 
-	// generate router.go file patch content
-	patchs, err := g.genPatchs(scope)
-	if err != nil {
-		return nil, err
-	}
-	if len(patchs) > 0 {
-		outputFilePath := path.Join(req.OutputPath, g.codeutils.GetFilePath(scope.AST()))
-		patchs[0].Name = &outputFilePath
-		g.resp.Contents = append(g.resp.Contents, patchs...)
+	// the packages of the types from the included files are imported by the generated code
+	g.importBase = args.PackagePrefix
+	if g.importBase == "" && args.Module != "" {
+		g.importBase = path.Join(args.Module, req.OutputPath)
 	}
 
-	if args.HandlerPath != "" {
-		name := args.HandlerPath
-		if path.Base(args.HandlerPath) == args.HandlerPath {
-			name = path.Join(req.OutputPath, pkg, args.HandlerPath)
-		}
-		handlers, err := g.genHandler(scope, name, desc)
+	// patch the tags of the structs in the thriftgo generated files, the included files are patched
+	// only if they are generated too, or the patchs would be taken as new files. It's an error if they have
+	// patchs but aren't generated and the handlers use them, the patchs are skipped with a warning otherwise.
+	asts := append([]*parser.Thrift{req.AST}, includedASTs(req.AST)...)
+	scopes := make([]*golang.Scope, 0, len(asts))
+	for _, ast := range asts {
+		s, err := golang.BuildScope(g.codeutils, ast)
 		if err != nil {
 			return nil, err
 		}
-		if len(handlers) > 0 {
-			g.resp.Contents = append(g.resp.Contents, handlers...)
-		}
+		scopes = append(scopes, s)
 	}
-
-	if args.RouterPath != "" {
-		name := args.RouterPath
-		if path.Base(args.RouterPath) == args.RouterPath {
-			name = path.Join(req.OutputPath, pkg, args.RouterPath)
-		}
-		routers, err := g.genRouter(scope, name, desc)
+	generated := scopes[:1]
+	if req.Recursive || args.IncludesGenerated {
+		generated = scopes
+	}
+	if g.redacted, err = g.redactedStructs(generated); err != nil {
+		return nil, err
+	}
+	used := g.handlerStructs(scope, scopes)
+	for i, ast := range asts {
+		patchs, err := g.genPatchs(scopes[i], path.Join(req.OutputPath, g.codeutils.GetFilePath(ast)))
 		if err != nil {
 			return nil, err
 		}
-		if len(routers) > 0 {
-			g.resp.Contents = append(g.resp.Contents, routers...)
+		if ast != req.AST && args.IncludesGenerated && !req.Recursive {
+			continue
 		}
+		if ast != req.AST && !req.Recursive {
+			// the included files aren't generated, so their structs can't be bound or redacted without the patchs
+			sensitive, err := g.redactedStructs(scopes[i : i+1])
+			if err != nil {
+				return nil, err
+			}
+			if len(patchs) == 0 && len(sensitive) == 0 {
+				continue
+			}
+			for _, sl := range scopes[i].StructLikes() {
+				patched, err := g.hasPatchs(sl)
+				if err != nil {
+					return nil, err
+				}
+				if used[sl] && (patched || sensitive[sl]) {
+					return nil, fmt.Errorf("the struct '%s' in the included '%s' has annotations to be patched into "+
+						"the generated code, generate it in recursive mode", sl.Name, ast.Filename)
+				}
+			}
+			g.warns = append(g.warns, fmt.Sprintf("the annotations of the structs in the included '%s' are skipped "+
+				"as it isn't generated, generate it in recursive mode to apply them", ast.Filename))
+			continue
+		}
+		g.resp.Contents = append(g.resp.Contents, patchs...)
 	}
 
-	if args.ServicePath != "" {
-		name := args.ServicePath
-		if path.Base(args.ServicePath) == args.ServicePath {
-			name = path.Join(req.OutputPath, pkg, args.ServicePath)
+	if args.IRPath != "" {
+		name := args.IRPath
+		if path.Base(args.IRPath) == args.IRPath {
+			name = path.Join(req.OutputPath, pkg, args.IRPath)
 		}
-		routers, err := g.genService(scope, name, desc)
+		irs, err := g.genIR(scope, scopes, name, desc)
 		if err != nil {
 			return nil, err
 		}
-		if len(routers) > 0 {
-			g.resp.Contents = append(g.resp.Contents, routers...)
-		}
+		g.resp.Contents = append(g.resp.Contents, irs...)
+	}
+
+	m, err := LoadTemplateManifest(args.TemplateDir)
+	if err != nil {
+		return nil, err
+	}
+	outputs := m.Resolve(map[string]string{
+		HandlerTemplate: args.HandlerPath,
+		RouterTemplate:  args.RouterPath,
+		ServiceTemplate: args.ServicePath,
+		MainTemplate:    args.MainPath,
+	})
+	generateds, err := g.genOutputs(outputs, req, args, scope, scopes, desc)
+	if err != nil {
+		return nil, err
 	}
+	g.resp.Contents = append(g.resp.Contents, generateds...)
 
 	g.resp.Warnings = g.warns
 	return g.resp, nil
@@ -0,0 +1,82 @@
+package thriftgo_tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeGenBlocks(t *testing.T) {
+	existing := `func register() {
+	// @register_gen begin
+	a.Register()
+	// @register_gen end
+	custom()
+}
+`
+	generated := `func register() {
+	// @register_gen begin
+	a.Register()
+	b.Register()
+	// @register_gen end
+}
+`
+	want := `func register() {
+	// @register_gen begin
+	a.Register()
+	b.Register()
+	// @register_gen end
+	custom()
+}
+`
+	got, err := mergeGenBlocks(existing, generated, []string{"register_gen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("unexpected merged file:\n%s", got)
+	}
+	// merging again adds nothing
+	if again, err := mergeGenBlocks(got, generated, []string{"register_gen"}); err != nil || again != want {
+		t.Errorf("unexpected merged file again: %v\n%s", err, again)
+	}
+}
+
+func TestReplaceGenBlocks(t *testing.T) {
+	cases := []struct {
+		name      string
+		existing  string
+		generated string
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "blocks replaced",
+			existing:  "custom\n// @a begin\nold\n// @a end\n// @b begin\nold\n// @b end\n",
+			generated: "// @a begin\nnew\n// @a end\n// @b begin\n// @b end\n",
+			want:      "custom\n// @a begin\nnew\n// @a end\n// @b begin\n// @b end\n",
+		},
+		{
+			name:      "block missing",
+			existing:  "custom\n",
+			generated: "// @a begin\nnew\n// @a end\n",
+			wantErr:   "'// @a begin' or '// @a end' not found",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := replaceGenBlocks(c.existing, c.generated)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("expect an error of '%s', got %v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Errorf("unexpected file:\n%s", got)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/cloudwego/thriftgo v0.1.7
 	github.com/duke-git/lancet/v2 v2.0.7
 	github.com/gin-gonic/gin v1.8.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -35,5 +36,4 @@ require (
 	golang.org/x/sys v0.0.0-20210806184541-e5e7981a1069 // indirect
 	golang.org/x/text v0.3.6 // indirect
 	google.golang.org/protobuf v1.28.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,339 @@
+package thriftgo_tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/cloudwego/thriftgo/generator/golang"
+	"github.com/cloudwego/thriftgo/parser"
+	"github.com/cloudwego/thriftgo/plugin"
+)
+
+// IRVersion is the version of the IR schema, it's increased on the incompatible changes of it.
+const IRVersion = 1
+
+// IR is the intermediate representation of a thrift file, the services are the http routes of the functions
+// and the structs are the schemas of the requests and responses. It's mapped from the descriptions of the
+// builtin templates but doesn't carry their go expressions, so that it's stable when they change.
+type IR struct {
+	Version   int          `json:"version"`
+	Generator string       `json:"generator"`
+	File      string       `json:"file"`
+	Services  []IRService  `json:"services"`
+	Structs   []StructDesc `json:"structs"` // the structs of the file and the files it includes
+}
+
+// IRService is a service in thrift and the routes of its functions.
+type IRService struct {
+	Name   string    `json:"name"`
+	Routes []IRRoute `json:"routes"`
+}
+
+// IRRoute is the http route of a service function.
+type IRRoute struct {
+	Method      string              `json:"method"`   // GET, PUT, POST or DELETE
+	Path        string              `json:"path"`     // the path with the parameters like /items/:id
+	Function    string              `json:"function"` // the name of the function in thrift
+	Annotations map[string][]string `json:"annotations"`
+	Request     IRRequest           `json:"request"`
+	Response    *IRResponse         `json:"response"` // nil if the function is oneway, the route replies 202 Accepted
+
+	Middlewares []string `json:"middlewares"`        // the names of the middlewares wrapping the route
+	Timeout     string   `json:"timeout,omitempty"`  // the deadline of the function like 2s, the route replies 504 when exceeded
+	MaxBody     int64    `json:"max_body,omitempty"` // the size limit of the request body in bytes, the route replies 413 when exceeded
+}
+
+// IRRequest is the request struct of a route and where its fields are bound from.
+type IRRequest struct {
+	Schema string    `json:"schema"` // the name of the struct in the structs of the IR
+	Params []IRParam `json:"params"`
+}
+
+// IRParam is where a field of the request is bound from and the rule it's validated with.
+type IRParam struct {
+	Field string `json:"field"`          // the name of the field in thrift
+	Name  string `json:"name"`           // the parameter name in its source, for body fields it's the json name
+	In    string `json:"in"`             // path, query, form, header, cookie or body
+	Rule  string `json:"rule,omitempty"` // the api.vd annotation of the field
+
+	// the uploaded files bound from multipart/form-data, each of them must not be larger than MaxSize bytes
+	File     bool  `json:"file,omitempty"`
+	List     bool  `json:"list,omitempty"`
+	Required bool  `json:"required,omitempty"`
+	MaxSize  int64 `json:"max_size,omitempty"`
+}
+
+// IRResponse is the response of a route.
+type IRResponse struct {
+	Type   string            `json:"type"`             // the thrift type, like list<example.Item>
+	Schema string            `json:"schema,omitempty"` // the name of the struct in the structs of the IR, empty if it isn't a struct
+	Fields []IRResponseField `json:"fields"`           // the fields written as the headers, the cookies or the status code
+	Stream *IRStream         `json:"stream,omitempty"` // the binary body replacing the json one
+}
+
+// IRResponseField is a field of the response which is left out of the json body.
+type IRResponseField struct {
+	Field string `json:"field"`          // the name of the field in thrift
+	Name  string `json:"name,omitempty"` // the header or cookie name
+	In    string `json:"in"`             // header, cookie or http_code
+}
+
+// IRStream is the binary body of a response.
+type IRStream struct {
+	Field              string `json:"field,omitempty"` // the field written as the body, empty if the response is binary
+	ContentType        string `json:"content_type"`
+	ContentDisposition string `json:"content_disposition,omitempty"`
+}
+
+// StructDesc is a struct, union or exception in thrift.
+type StructDesc struct {
+	Name        string              `json:"name"` // the name qualified by the file defining it, like example.GetRequest
+	GoName      string              `json:"go_name"`
+	Category    string              `json:"category"` // struct, union or exception
+	File        string              `json:"file"`
+	Fields      []StructFieldDesc   `json:"fields"`
+	Annotations map[string][]string `json:"annotations"`
+}
+
+type StructFieldDesc struct {
+	ID           int32               `json:"id"`
+	Name         string              `json:"name"`
+	GoName       string              `json:"go_name"`
+	Type         string              `json:"type"` // the thrift type, like list<base.Item>
+	GoType       string              `json:"go_type"`
+	Requiredness string              `json:"requiredness"` // required, optional or default
+	JSONName     string              `json:"json_name"`
+	Annotations  map[string][]string `json:"annotations"`
+}
+
+// LoadIR loads the IR written by the generator, the IR of another version is rejected.
+func LoadIR(data []byte) (*IR, error) {
+	ir := &IR{}
+	if err := json.Unmarshal(data, ir); err != nil {
+		return nil, err
+	}
+	if ir.Version != IRVersion {
+		return nil, fmt.Errorf("unsupported IR version %d, it should be %d", ir.Version, IRVersion)
+	}
+	return ir, nil
+}
+
+func annotationMap(annotations parser.Annotations) map[string][]string {
+	m := make(map[string][]string, len(annotations))
+	for _, a := range annotations {
+		m[a.Key] = append(m[a.Key], a.Values...)
+	}
+	return m
+}
+
+// irTypeName returns the type in the thrift syntax with the structs named like the schemas of the IR,
+// like list<example.Item>. The typedefs are resolved.
+func (g *Generator) irTypeName(scope *golang.Scope, t *parser.Type) string {
+	scope, t = resolveTypedef(scope, t)
+	switch {
+	case t.KeyType != nil && t.ValueType != nil:
+		return fmt.Sprintf("%s<%s,%s>", t.Name, g.irTypeName(scope, t.KeyType), g.irTypeName(scope, t.ValueType))
+	case t.ValueType != nil:
+		return fmt.Sprintf("%s<%s>", t.Name, g.irTypeName(scope, t.ValueType))
+	}
+	if sl := g.getStructLike(scope, t); sl != nil {
+		return g.schemaName(scope, t, sl)
+	}
+	return t.Name
+}
+
+func schemaFileName(ast *parser.Thrift) string {
+	return strings.TrimSuffix(filepath.Base(ast.Filename), ".thrift")
+}
+
+// schemaName returns the name of the struct of the type in the IR.
+func (g *Generator) schemaName(scope *golang.Scope, t *parser.Type, sl *golang.StructLike) string {
+	scope, t = resolveTypedef(scope, t)
+	if ref := t.GetReference(); ref != nil {
+		if include := scope.Includes().ByIndex(int(ref.Index)); include != nil {
+			scope = include.Scope
+		}
+	}
+	return schemaFileName(scope.AST()) + "." + sl.Name
+}
+
+func (g *Generator) getStructDesc(scope *golang.Scope, sl *golang.StructLike) (StructDesc, error) {
+	sd := StructDesc{
+		Name:        schemaFileName(scope.AST()) + "." + sl.Name,
+		GoName:      sl.GoName().String(),
+		Category:    sl.Category,
+		File:        scope.AST().Filename,
+		Fields:      make([]StructFieldDesc, 0, len(sl.Fields())),
+		Annotations: annotationMap(sl.Annotations),
+	}
+	for _, f := range sl.Fields() {
+		name, _, err := g.jsonName(f)
+		if err != nil {
+			return sd, err
+		}
+		sd.Fields = append(sd.Fields, StructFieldDesc{
+			ID:           f.ID,
+			Name:         f.Name,
+			GoName:       f.GoName().String(),
+			Type:         g.irTypeName(scope, f.Type),
+			GoType:       f.GoTypeName().String(),
+			Requiredness: strings.ToLower(f.Requiredness.String()),
+			JSONName:     name,
+			Annotations:  annotationMap(f.Annotations),
+		})
+	}
+	return sd, nil
+}
+
+// getIR describes the services of the scope and the structs of the scopes, which are the scope
+// and the ones it includes.
+func (g *Generator) getIR(scope *golang.Scope, scopes []*golang.Scope, desc Desc) (*IR, error) {
+	ir := &IR{
+		Version:   IRVersion,
+		Generator: Version,
+		File:      scope.AST().Filename,
+		Services:  make([]IRService, 0, 1),
+		Structs:   make([]StructDesc, 0),
+	}
+	if len(scope.Services()) > 0 {
+		s, err := g.getServiceDesc(scope, desc)
+		if err != nil {
+			return nil, err
+		}
+		ir.Services = append(ir.Services, irService(s))
+	}
+	for _, s := range scopes {
+		for _, sl := range s.StructLikes() {
+			sd, err := g.getStructDesc(s, sl)
+			if err != nil {
+				return nil, err
+			}
+			ir.Structs = append(ir.Structs, sd)
+		}
+	}
+	return ir, nil
+}
+
+// irService maps the description of a service to the IR, the go expressions of the templates are left out.
+func irService(s *ServiceDesc) IRService {
+	service := IRService{Name: s.ServiceName, Routes: make([]IRRoute, 0, len(s.Handlers))}
+	for _, h := range s.Handlers {
+		route := IRRoute{
+			Method:      h.HTTPMethod,
+			Path:        h.Route,
+			Function:    h.FunctionName,
+			Annotations: h.Annotations,
+			Request:     IRRequest{Schema: h.RequestSchema, Params: make([]IRParam, 0, len(h.RequestFields))},
+			Middlewares: h.Middlewares,
+			MaxBody:     h.MaxBody,
+		}
+		if route.Middlewares == nil {
+			route.Middlewares = []string{}
+		}
+		if h.Timeout > 0 {
+			route.Timeout = h.Timeout.String()
+		}
+		for _, f := range h.RequestFields {
+			route.Request.Params = append(route.Request.Params, IRParam{
+				Field:    f.field,
+				Name:     f.Name,
+				In:       f.In,
+				Rule:     f.Rule,
+				File:     f.IsFile,
+				List:     f.IsList,
+				Required: f.Required,
+				MaxSize:  f.MaxSize,
+			})
+		}
+		if !h.Oneway {
+			route.Response = irResponse(h)
+		}
+		service.Routes = append(service.Routes, route)
+	}
+	return service
+}
+
+func irResponse(h HandlerDesc) *IRResponse {
+	resp := &IRResponse{Type: h.responseType, Schema: h.ResponseSchema, Fields: make([]IRResponseField, 0)}
+	for _, f := range h.ResponseFields {
+		// the i64 fields encoded as strings are described by the json names of the struct
+		if f.In == "js_conv" {
+			continue
+		}
+		resp.Fields = append(resp.Fields, IRResponseField{Field: f.field, Name: f.Name, In: f.In})
+	}
+	if h.RawBody != "" {
+		resp.Stream = &IRStream{
+			Field:              h.rawBodyField,
+			ContentType:        h.ContentType,
+			ContentDisposition: h.ContentDisposition,
+		}
+	}
+	return resp
+}
+
+func (g *Generator) genIR(scope *golang.Scope, scopes []*golang.Scope, name string, desc Desc) ([]*plugin.Generated, error) {
+	ir, err := g.getIR(scope, scopes, desc)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(ir, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []*plugin.Generated{
+		{
+			Name:    &name,
+			Content: string(data) + "\n",
+		},
+	}, nil
+}
+
+// Render executes the templates in the directory with the IR, the file of a template is named after it
+// without the .tmpl suffix, like docs/api.md for docs/api.md.tmpl. The names are relative to the directory.
+// The builtin templates of the backends and the ones the manifest generates per service are skipped, they're
+// executed with the go descriptions of the generator rather than the IR.
+func (g *Generator) Render(ir *IR, dir string) ([]*plugin.Generated, error) {
+	m, err := LoadTemplateManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	generateds := make([]*plugin.Generated, 0)
+	err = filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(name, ".tmpl") {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		if !m.isIRTemplate(filepath.ToSlash(rel)) {
+			return nil
+		}
+		text, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tpl, err := template.New(rel).Funcs(g.tplFuncs).Parse(string(text))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, ir); err != nil {
+			return err
+		}
+		out := strings.TrimSuffix(rel, ".tmpl")
+		generateds = append(generateds, &plugin.Generated{Name: &out, Content: buf.String()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generateds, nil
+}
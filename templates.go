@@ -0,0 +1,255 @@
+package thriftgo_tools
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Templates are the builtin code templates, they're copied into the projects created by httpgen init.
+//
+//go:embed templates
+var Templates embed.FS
+
+// TemplateManifestFile declares the outputs of a template directory, like the clients or the mocks of the
+// services. The builtin outputs are its default entries, an entry of a builtin template replaces them.
+const TemplateManifestFile = "templates.yaml"
+
+// The builtin templates, their outputs are at the paths given by the arguments of the generator unless the
+// manifest has entries of them.
+const (
+	HandlerTemplate = "handler.tmpl"
+	RouterTemplate  = "router.tmpl"
+	ServiceTemplate = "service.tmpl"
+	MainTemplate    = "main.tmpl"
+)
+
+var builtinTemplates = []string{HandlerTemplate, RouterTemplate, ServiceTemplate, MainTemplate}
+
+// partialTemplates are the other templates executed by the generator with its go descriptions, like the
+// routes inserted into the router and the methods patched into the thriftgo generated structs.
+var partialTemplates = []string{"router_body.tmpl", "js_conv.tmpl", "redact.tmpl", "metadata.tmpl"}
+
+// The overwrite policies of an output.
+const (
+	OverwriteAlways     = "always"      // the file is generated again every time
+	OverwriteCreateOnly = "create-only" // the file is generated once, then it's left to the users
+	OverwriteMerge      = "merge"       // the generated blocks of the file are replaced, the rest is kept
+)
+
+// The scopes an output is generated in.
+const (
+	PerService = "service" // the output is generated for the service of a thrift file, the data is a ServiceDesc
+	PerFile    = "file"    // the output is generated for every thrift file, the data is the IR of it
+)
+
+// TemplateManifest is the schema of the TemplateManifestFile.
+type TemplateManifest struct {
+	Outputs []OutputSpec `yaml:"outputs"`
+}
+
+// OutputSpec is a file generated by a template of the directory. The builtin templates merge the existing
+// files by themselves unless they're generated per file, which executes them with the IR like the others.
+type OutputSpec struct {
+	Template  string `yaml:"template"`            // the template in the directory, like client.tmpl
+	Path      string `yaml:"path"`                // the pattern of the path relative to the output, like {{ .PkgName }}/client.gen.go
+	Overwrite string `yaml:"overwrite,omitempty"` // always, create-only or merge, the default is always
+	Per       string `yaml:"per,omitempty"`       // service or file, the default is service
+	Skip      bool   `yaml:"skip,omitempty"`      // the builtin output of the template isn't generated
+
+	file string // the path of a builtin output given by the arguments, it's used if Path is empty
+}
+
+// builtin reports whether the output is generated by a builtin template with its own merging.
+func (o OutputSpec) builtin() bool {
+	return o.Per == PerService && isBuiltinTemplate(o.Template)
+}
+
+func isBuiltinTemplate(name string) bool {
+	for _, t := range builtinTemplates {
+		if name == t {
+			return true
+		}
+	}
+	return false
+}
+
+// isIRTemplate reports whether the template of the directory is executed with the IR. They're the ones the
+// manifest generates per file, and the ones it doesn't declare besides the builtin and partial ones.
+func (m *TemplateManifest) isIRTemplate(name string) bool {
+	for _, o := range m.Outputs {
+		if o.Template == name {
+			return o.Per == PerFile
+		}
+	}
+	if isBuiltinTemplate(name) {
+		return false
+	}
+	for _, t := range partialTemplates {
+		if name == t {
+			return false
+		}
+	}
+	return true
+}
+
+// OutputPathDesc is the data of the path pattern of an output.
+type OutputPathDesc struct {
+	PkgName     string // the go package of the thrift file, like example
+	FileName    string // the thrift file without the directory and the .thrift suffix, like example
+	ServiceName string // the service of the thrift file, it's empty for the outputs per file without a service
+}
+
+// LoadTemplateManifest loads the outputs declared in the template directory, there's none if the directory
+// has no manifest.
+func LoadTemplateManifest(dir string) (*TemplateManifest, error) {
+	name := filepath.Join(dir, TemplateManifestFile)
+	data, err := ioutil.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return &TemplateManifest{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	m := &TemplateManifest{}
+	if err := yaml.UnmarshalStrict(data, m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	var violations []string
+	declared := make(map[string]bool)
+	for i := range m.Outputs {
+		o := &m.Outputs[i]
+		field := fmt.Sprintf("outputs[%d]", i)
+		builtin := isBuiltinTemplate(o.Template)
+		if builtin && declared[o.Template] {
+			violations = append(violations, fmt.Sprintf("%s.template: the builtin '%s' is declared more than once", field, o.Template))
+		}
+		declared[o.Template] = true
+		if o.Skip {
+			if !builtin {
+				violations = append(violations, fmt.Sprintf("%s.skip: '%s' isn't a builtin template, remove the entry instead",
+					field, o.Template))
+			}
+			continue
+		}
+		if o.Template == "" {
+			violations = append(violations, field+".template: is required")
+		} else if _, err := os.Stat(filepath.Join(dir, o.Template)); err != nil {
+			violations = append(violations, fmt.Sprintf("%s.template: '%s' doesn't exist", field, o.Template))
+		}
+		// the builtin outputs are at the paths of the arguments by default
+		if o.Path == "" && !builtin {
+			violations = append(violations, field+".path: is required")
+		} else if _, err := template.New(o.Path).Parse(o.Path); err != nil {
+			violations = append(violations, fmt.Sprintf("%s.path: %v", field, err))
+		}
+		if builtin && o.Overwrite != "" && o.Per != PerFile {
+			violations = append(violations, fmt.Sprintf("%s.overwrite: the builtin '%s' merges the existing file by itself, "+
+				"the policy applies to it only per %s", field, o.Template, PerFile))
+		}
+		if o.Overwrite == "" {
+			o.Overwrite = OverwriteAlways
+		}
+		if o.Overwrite != OverwriteAlways && o.Overwrite != OverwriteCreateOnly && o.Overwrite != OverwriteMerge {
+			violations = append(violations, fmt.Sprintf("%s.overwrite: unknown policy '%s', it should be one of %s, %s, %s",
+				field, o.Overwrite, OverwriteAlways, OverwriteCreateOnly, OverwriteMerge))
+		}
+		if o.Per == "" {
+			o.Per = PerService
+		}
+		if o.Per != PerService && o.Per != PerFile {
+			violations = append(violations, fmt.Sprintf("%s.per: unknown scope '%s', it should be %s or %s",
+				field, o.Per, PerService, PerFile))
+		}
+	}
+	if len(violations) > 0 {
+		return nil, fmt.Errorf("invalid %s:\n  %s", name, strings.Join(violations, "\n  "))
+	}
+	return m, nil
+}
+
+// Resolve returns the outputs of the template directory. They're the builtin ones at the paths given by the
+// arguments, keyed by the templates, and the ones of the manifest. An entry of a builtin template replaces its
+// default one, so that it can be renamed, skipped or generated per file. The builtin ones come first.
+func (m *TemplateManifest) Resolve(paths map[string]string) []OutputSpec {
+	outputs := make([]OutputSpec, 0, len(builtinTemplates)+len(m.Outputs))
+	for _, name := range builtinTemplates {
+		o := OutputSpec{Template: name, Per: PerService, file: paths[name]}
+		for _, declared := range m.Outputs {
+			if declared.Template == name {
+				o, o.file = declared, paths[name]
+			}
+		}
+		if !o.Skip && (o.Path != "" || o.file != "") {
+			outputs = append(outputs, o)
+		}
+	}
+	for _, o := range m.Outputs {
+		if !isBuiltinTemplate(o.Template) {
+			outputs = append(outputs, o)
+		}
+	}
+	return outputs
+}
+
+// outputName returns the file of the output, the path of the arguments is relative to the working directory,
+// or the package of the thrift file if it's a file name. The main isn't generated into the package.
+func (o OutputSpec) outputName(outputPath string, desc OutputPathDesc) (string, error) {
+	if o.Path == "" {
+		if path.Base(o.file) == o.file && o.Template != MainTemplate {
+			return path.Join(outputPath, desc.PkgName, o.file), nil
+		}
+		return o.file, nil
+	}
+	rel, err := o.outputPath(desc)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(outputPath, rel), nil
+}
+
+// outputPath executes the path pattern of the output, the path is relative to the output and it stays in it.
+func (o OutputSpec) outputPath(desc OutputPathDesc) (string, error) {
+	tpl, err := template.New(o.Path).Option("missingkey=error").Parse(o.Path)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, desc); err != nil {
+		return "", err
+	}
+	name := path.Clean(buf.String())
+	if path.IsAbs(name) || name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("the path '%s' of template %s is out of the output", buf.String(), o.Template)
+	}
+	return name, nil
+}
+
+var genBlockPattern = regexp.MustCompile(`// @(\w+) begin`)
+
+// replaceGenBlocks replaces the blocks in existing with the ones in generated, a block is the lines between
+// the comments '// @<block> begin' and '// @<block> end', the code outside the blocks is kept.
+func replaceGenBlocks(existing, generated string) (string, error) {
+	for _, m := range genBlockPattern.FindAllStringSubmatch(generated, -1) {
+		gb, ge, err := genBlock(generated, m[1])
+		if err != nil {
+			return "", err
+		}
+		eb, ee, err := genBlock(existing, m[1])
+		if err != nil {
+			return "", err
+		}
+		existing = existing[:eb] + generated[gb:ge] + existing[ee:]
+	}
+	return existing, nil
+}